@@ -122,6 +122,7 @@ func (m *MiriaClient) CheckAuthentication() error {
 			return err
 		}
 	}
+	m.authChecked = true
 	return nil
 }
 
@@ -17,16 +17,56 @@ along with this program. If not, see <http://www.gnu.org/licenses/>.
 
 package client
 
+import (
+	"sync"
+	"sync/atomic"
+)
+
 type MiriaClient struct {
-	apiUrl string
-	host   string
-	auth   AuthToken
+	apiUrl      string
+	host        string
+	auth        AuthToken
+	authMutex   sync.Mutex
+	authChecked bool
+	concurrency int
+	requests    chan struct{}
+	pageSize    int
+	// the server rejected or ignored depth rules, see fetchPages
+	noDepthRules atomic.Bool
+	// the server returned results satisfying depth rules, see fetchPage
+	depthRulesSeen atomic.Bool
 }
 
+const DefaultConcurrency = 4
+
 func NewMiria(host string) *MiriaClient {
 	m := new(MiriaClient)
 	m.host = host
 	m.apiUrl = "http://" + m.host + "/restapi"
+	m.SetConcurrency(DefaultConcurrency)
+	m.SetPageSize(DefaultPageSize)
 
 	return m
 }
+
+// Set maximum number of concurrent HTTP requests /////////////////////////////
+func (m *MiriaClient) SetConcurrency(n int) {
+	if n < 1 {
+		n = 1
+	}
+	m.concurrency = n
+	m.requests = make(chan struct{}, n)
+}
+
+// Maximum number of concurrent HTTP requests
+func (m *MiriaClient) Concurrency() int {
+	return m.concurrency
+}
+
+// Set default number of results per search page //////////////////////////////
+func (m *MiriaClient) SetPageSize(n int) {
+	if n < 1 {
+		n = DefaultPageSize
+	}
+	m.pageSize = n
+}
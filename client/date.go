@@ -0,0 +1,51 @@
+/*
+Copyright © 2022 Antonin Portelli <antonin.portelli@me.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package client
+
+import (
+	"fmt"
+	"time"
+)
+
+// Layout used by the Miria server for dates in search requests
+const BackupDateLayout = "2006-01-02T15:04:05"
+
+var backupDateLayouts = []string{
+	time.RFC3339Nano,
+	BackupDateLayout,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+// Parse backup date as returned by the server ////////////////////////////////
+func ParseBackupDate(date string) (time.Time, error) {
+	for _, layout := range backupDateLayouts {
+		t, err := time.ParseInLocation(layout, date, time.Local)
+		if err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("cannot parse date '%s'", date)
+}
+
+// Backup date of a search result, zero time if it cannot be parsed ///////////
+func (r SearchResult) BackupTime() time.Time {
+	t, _ := ParseBackupDate(r.InstanceBackupDate)
+	return t
+}
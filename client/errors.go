@@ -0,0 +1,59 @@
+/*
+Copyright © 2022 Antonin Portelli <antonin.portelli@me.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Returned when no Miria host is configured
+var ErrNoHost = errors.New("host empty, please configure a host with `miria config set host <host>`")
+
+// HTTP error status returned by the server, Response is the decoded body if any
+type HTTPError struct {
+	StatusCode int
+	Response   map[string]any
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("the Miria server returned HTTP response %d", e.StatusCode)
+}
+
+// Error reported by the server in a successful HTTP response
+type ServerError struct {
+	Response map[string]any
+}
+
+func (e *ServerError) Error() string {
+	message, _ := json.MarshalIndent(e.Response, "", "  ")
+	return fmt.Sprintf("the Miria server returned an error\n%s", string(message))
+}
+
+// Server response that cannot be decoded
+type DecodeError struct {
+	Err error
+}
+
+func (e *DecodeError) Error() string {
+	return "cannot decode server response: " + e.Err.Error()
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
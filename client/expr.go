@@ -0,0 +1,605 @@
+/*
+Copyright © 2022 Antonin Portelli <antonin.portelli@me.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package client
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Boolean expression over search results. An expression is compiled into
+// advanced-search criteria (pushdown), and evaluated client-side on the
+// returned results for anything the server cannot express exactly.
+type Expr interface {
+	// Evaluate expression on a search result
+	Match(r SearchResult) bool
+	// Criteria matching a superset of the expression (FindRule, FindCriteria
+	// or nil to match everything), exact is true if there is no superset
+	pushdown() (crit any, exact bool)
+}
+
+// Whether the search result is a directory ////////////////////////////////////
+func (r SearchResult) IsDir() bool {
+	switch strings.ToUpper(r.ObjectType) {
+	case "D", "DIR", "DIRECTORY", "FOLDER", "2", "3":
+		return true
+	}
+	return false
+}
+
+// Logical operators //////////////////////////////////////////////////////////
+type andExpr []Expr
+type orExpr []Expr
+type notExpr struct{ e Expr }
+
+func (e andExpr) Match(r SearchResult) bool {
+	for _, c := range e {
+		if !c.Match(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func (e andExpr) pushdown() (any, bool) {
+	var rules []any
+	exact := true
+	for _, c := range e {
+		crit, cexact := c.pushdown()
+		exact = exact && cexact
+		if crit != nil {
+			rules = append(rules, crit)
+		}
+	}
+	switch len(rules) {
+	case 0:
+		return nil, exact
+	case 1:
+		return rules[0], exact
+	default:
+		return FindCriteria{Condition: "AND", Rules: rules}, exact
+	}
+}
+
+func (e orExpr) Match(r SearchResult) bool {
+	for _, c := range e {
+		if c.Match(r) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e orExpr) pushdown() (any, bool) {
+	var rules []any
+	exact := true
+	for _, c := range e {
+		crit, cexact := c.pushdown()
+		if crit == nil {
+			// one branch matches everything, so does the disjunction
+			return nil, false
+		}
+		exact = exact && cexact
+		rules = append(rules, crit)
+	}
+	if len(rules) == 1 {
+		return rules[0], exact
+	}
+	return FindCriteria{Condition: "OR", Rules: rules}, exact
+}
+
+func (e notExpr) Match(r SearchResult) bool {
+	return !e.e.Match(r)
+}
+
+func (e notExpr) pushdown() (any, bool) {
+	if t, ok := e.e.(typeExpr); ok {
+		return typeExpr{dir: !t.dir}.pushdown()
+	}
+	return nil, false
+}
+
+// File name //////////////////////////////////////////////////////////////////
+type nameExpr struct{ pattern string }
+
+func (e nameExpr) Match(r SearchResult) bool {
+	return MatchGlob(e.pattern, r.ObjectName, false)
+}
+
+func (e nameExpr) pushdown() (any, bool) {
+	rule := func(val any, op string) FindRule {
+		return FindRule{Type: "FILE_NAME", Value: val, Value2: nil, Operator: op}
+	}
+	if e.pattern == "*" || e.pattern == "" {
+		return nil, true
+	}
+	if !hasMeta(e.pattern) {
+		return rule(e.pattern, "equal"), true
+	}
+	if strings.ContainsAny(e.pattern, "?[\\") {
+		return nil, false
+	}
+
+	// pattern only contains stars, split on them
+	split := strings.Split(e.pattern, "*")
+	var rules []any
+	if split[0] != "" {
+		rules = append(rules, rule(split[0], "starts with"))
+	}
+	for _, s := range split[1 : len(split)-1] {
+		if s != "" {
+			rules = append(rules, rule(s, "contains"))
+		}
+	}
+	if split[len(split)-1] != "" {
+		rules = append(rules, rule(split[len(split)-1], "ends with"))
+	}
+	// the rules do not constrain the order of the pieces if there are more
+	// than one of them
+	exact := len(rules) <= 1
+	switch len(rules) {
+	case 0:
+		return nil, true
+	case 1:
+		return rules[0], exact
+	}
+	return FindCriteria{Condition: "AND", Rules: rules}, exact
+}
+
+// Full object path, with or without the archive prefix //////////////////////
+type pathExpr struct {
+	pattern string
+	fold    bool
+}
+
+func (e pathExpr) Match(r SearchResult) bool {
+	_, p := SplitObjectPath(r.ObjectPath)
+	return MatchGlob(e.pattern, r.ObjectPath, e.fold) || MatchGlob(e.pattern, p, e.fold)
+}
+
+func (e pathExpr) pushdown() (any, bool) {
+	return nil, false
+}
+
+// Exact object path, the server only matches the name ////////////////////////
+type exactPathExpr string
+
+func (e exactPathExpr) Match(r SearchResult) bool {
+	return CleanObjectPath(r.ObjectPath) == string(e)
+}
+
+func (e exactPathExpr) pushdown() (any, bool) {
+	_, p := SplitObjectPath(string(e))
+	name := p[strings.LastIndex(p, "/")+1:]
+	return FindRule{Type: "FILE_NAME", Value: name, Value2: nil, Operator: "equal"}, false
+}
+
+// Path or one of its ancestors ///////////////////////////////////////////////
+// Patterns without '/' are matched against each path component, others are
+// matched against each ancestor path, with or without the archive prefix. Only
+// the components below the search root are checked.
+type ancestorExpr struct {
+	pattern string
+	root    string
+	self    bool // also match the path itself
+}
+
+func (e ancestorExpr) Match(r SearchResult) bool {
+	prefix, p := SplitObjectPath(r.ObjectPath)
+	component := !strings.Contains(e.pattern, "/")
+	start := 0
+	if UnderPath(r.ObjectPath, e.root) {
+		_, root := SplitObjectPath(e.root)
+		start = len(strings.TrimSuffix(root, "/"))
+	}
+	for end := start; end < len(p); {
+		next := strings.IndexByte(p[end+1:], '/')
+		if next < 0 {
+			if !e.self {
+				break
+			}
+			next = len(p)
+		} else {
+			next += end + 1
+		}
+		if component {
+			if next > end+1 && MatchGlob(e.pattern, p[end+1:next], false) {
+				return true
+			}
+		} else if MatchGlob(e.pattern, p[:next], false) || MatchGlob(e.pattern, prefix+p[:next], false) {
+			return true
+		}
+		end = next
+	}
+	return false
+}
+
+func (e ancestorExpr) pushdown() (any, bool) {
+	return nil, false
+}
+
+// Exclude paths matching pattern below root and everything below them
+func excludeExpr(pattern string, root string) Expr {
+	return notExpr{ancestorExpr{pattern: pattern, root: CleanObjectPath(root), self: true}}
+}
+
+// Exclude everything below directories matching pattern below root
+func pruneExpr(pattern string, root string) Expr {
+	return notExpr{ancestorExpr{pattern: pattern, root: CleanObjectPath(root), self: false}}
+}
+
+// Depth relative to the search root ////////////////////////////////////////
+type depthExpr struct {
+	root     int
+	min, max int // max is unlimited if negative
+}
+
+func (e depthExpr) Match(r SearchResult) bool {
+	d := PathDepth(r.ObjectPath) - e.root
+	return d >= e.min && (e.max < 0 || d <= e.max)
+}
+
+// Rule type of the depth bounds, not supported by every server version
+const depthRule = "PATH_DEPTH"
+
+// Absolute depth bounds, so the server can avoid scanning deeper levels. The
+// bounds are always checked client-side, and dropped from the criteria if the
+// server rejects or ignores them (see fetchPages).
+func (e depthExpr) pushdown() (any, bool) {
+	var rules []any
+	if e.min > 0 {
+		rules = append(rules, FindRule{Type: depthRule, Value: e.root + e.min, Value2: nil,
+			Operator: "greater or equal"})
+	}
+	if e.max >= 0 {
+		rules = append(rules, FindRule{Type: depthRule, Value: e.root + e.max, Value2: nil,
+			Operator: "less or equal"})
+	}
+	switch len(rules) {
+	case 0:
+		return nil, true
+	case 1:
+		return rules[0], false
+	default:
+		return FindCriteria{Condition: "AND", Rules: rules}, false
+	}
+}
+
+// Whether the depth of all results satisfies the depth rules of the criteria
+func depthHonoured(c FindCriteria, results []SearchResult) bool {
+	for _, r := range c.Rules {
+		switch r := r.(type) {
+		case FindRule:
+			bound, ok := r.Value.(int)
+			if r.Type != depthRule || !ok {
+				continue
+			}
+			for _, res := range results {
+				d := PathDepth(res.ObjectPath)
+				if r.Operator == "greater or equal" && d < bound || r.Operator == "less or equal" && d > bound {
+					return false
+				}
+			}
+		case FindCriteria:
+			if !depthHonoured(r, results) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Criteria without the depth rules, found is false if there was none. Depth
+// rules are only combined with AND, so the result matches a superset.
+func withoutDepthRules(c FindCriteria) (crit FindCriteria, found bool) {
+	crit.Condition = c.Condition
+	for _, r := range c.Rules {
+		switch r := r.(type) {
+		case FindRule:
+			if r.Type == depthRule {
+				found = true
+				continue
+			}
+			crit.Rules = append(crit.Rules, r)
+		case FindCriteria:
+			sub, subFound := withoutDepthRules(r)
+			found = found || subFound
+			if len(sub.Rules) > 0 {
+				crit.Rules = append(crit.Rules, sub)
+			}
+		default:
+			crit.Rules = append(crit.Rules, r)
+		}
+	}
+	return crit, found
+}
+
+// File type //////////////////////////////////////////////////////////////////
+type typeExpr struct{ dir bool }
+
+func newTypeExpr(t string) (Expr, error) {
+	switch t {
+	case "f":
+		return typeExpr{dir: false}, nil
+	case "d":
+		return typeExpr{dir: true}, nil
+	default:
+		return nil, fmt.Errorf("unknown file type '%s'", t)
+	}
+}
+
+func (e typeExpr) Match(r SearchResult) bool {
+	return r.IsDir() == e.dir
+}
+
+func (e typeExpr) pushdown() (any, bool) {
+	if e.dir {
+		return FindRule{Type: "FILE_TYPE", Value: []int{2, 3}, Value2: nil, Operator: "in"}, true
+	}
+	return FindRule{Type: "FILE_TYPE", Value: 1, Value2: nil, Operator: "equals to"}, true
+}
+
+// File size, the check is always repeated client-side ///////////////////////
+type sizeExpr struct {
+	cmp  int // -1: less than, 0: equal, 1: greater than
+	size uint64
+}
+
+var sizeUnits = map[byte]uint64{
+	'c': 1, 'k': 1 << 10, 'K': 1 << 10, 'M': 1 << 20, 'G': 1 << 30, 'T': 1 << 40, 'P': 1 << 50,
+}
+
+// Parse size such as +10M, -1k, 100 (bytes) or 100c
+func newSizeExpr(s string) (Expr, error) {
+	var e sizeExpr
+
+	num := s
+	if strings.HasPrefix(num, "+") {
+		e.cmp = 1
+		num = num[1:]
+	} else if strings.HasPrefix(num, "-") {
+		e.cmp = -1
+		num = num[1:]
+	}
+	unit := uint64(1)
+	if len(num) > 0 {
+		if u, ok := sizeUnits[num[len(num)-1]]; ok {
+			unit = u
+			num = num[:len(num)-1]
+		}
+	}
+	n, err := strconv.ParseUint(num, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid size '%s'", s)
+	}
+	e.size = n * unit
+	return e, nil
+}
+
+func (e sizeExpr) Match(r SearchResult) bool {
+	switch e.cmp {
+	case -1:
+		return r.ObjectSize < e.size
+	case 1:
+		return r.ObjectSize > e.size
+	default:
+		return r.ObjectSize == e.size
+	}
+}
+
+func (e sizeExpr) pushdown() (any, bool) {
+	op := map[int]string{-1: "less", 0: "equal", 1: "greater"}[e.cmp]
+	return FindRule{Type: "FILE_SIZE", Value: e.size, Value2: nil, Operator: op}, false
+}
+
+// Repository, evaluated client-side only /////////////////////////////////////
+type repositoryExpr []int
+
+func (e repositoryExpr) Match(r SearchResult) bool {
+	for _, id := range e {
+		if r.RepositoryId == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (e repositoryExpr) pushdown() (any, bool) {
+	return nil, false
+}
+
+// Backup date, the check is always repeated client-side //////////////////////
+type dateExpr struct{ since, until time.Time }
+
+func (e dateExpr) Match(r SearchResult) bool {
+	t := r.BackupTime()
+	if !e.since.IsZero() && t.Before(e.since) {
+		return false
+	}
+	if !e.until.IsZero() && !t.Before(e.until) {
+		return false
+	}
+	return true
+}
+
+func (e dateExpr) pushdown() (any, bool) {
+	var rules []any
+	if !e.since.IsZero() {
+		rules = append(rules, FindRule{Type: "BACKUP_DATE", Value: e.since.Format(BackupDateLayout),
+			Value2: nil, Operator: "greater or equal"})
+	}
+	if !e.until.IsZero() {
+		rules = append(rules, FindRule{Type: "BACKUP_DATE", Value: e.until.Format(BackupDateLayout),
+			Value2: nil, Operator: "less"})
+	}
+	switch len(rules) {
+	case 0:
+		return nil, true
+	case 1:
+		return rules[0], false
+	default:
+		return FindCriteria{Condition: "AND", Rules: rules}, false
+	}
+}
+
+// Parser /////////////////////////////////////////////////////////////////////
+type exprParser struct {
+	tokens []string
+	pos    int
+}
+
+// Parse a GNU find-like expression, e.g.
+//
+//	\( -name '*.h5' -o -name '*.nc' \) -not -path '*/tmp/*'
+//
+// Supported primaries are -name, -path, -ipath, -type and -size, combined
+// with -a/-and (implicit), -o/-or, !/-not and parentheses.
+func ParseExpression(tokens []string) (Expr, error) {
+	if len(tokens) == 0 {
+		return andExpr{}, nil
+	}
+	p := exprParser{tokens: tokens}
+	e, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected '%s' in expression", p.tokens[p.pos])
+	}
+	return e, nil
+}
+
+func (p *exprParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *exprParser) next() (string, bool) {
+	if p.pos < len(p.tokens) {
+		p.pos++
+		return p.tokens[p.pos-1], true
+	}
+	return "", false
+}
+
+func (p *exprParser) parseOr() (Expr, error) {
+	e, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	or := orExpr{e}
+	for t := p.peek(); t == "-o" || t == "-or"; t = p.peek() {
+		p.pos++
+		e, err = p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		or = append(or, e)
+	}
+	if len(or) == 1 {
+		return or[0], nil
+	}
+	return or, nil
+}
+
+func (p *exprParser) parseAnd() (Expr, error) {
+	e, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	and := andExpr{e}
+	for {
+		t := p.peek()
+		if t == "" || t == ")" || t == "-o" || t == "-or" {
+			break
+		}
+		if t == "-a" || t == "-and" {
+			p.pos++
+		}
+		e, err = p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		and = append(and, e)
+	}
+	if len(and) == 1 {
+		return and[0], nil
+	}
+	return and, nil
+}
+
+func (p *exprParser) parseUnary() (Expr, error) {
+	t, ok := p.next()
+	if !ok {
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+	arg := func() (string, error) {
+		a, ok := p.next()
+		if !ok {
+			return "", fmt.Errorf("missing argument to '%s'", t)
+		}
+		return a, nil
+	}
+	switch t {
+	case "!", "-not":
+		e, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notExpr{e}, nil
+	case "(":
+		e, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if c, _ := p.next(); c != ")" {
+			return nil, fmt.Errorf("missing ')' in expression")
+		}
+		return e, nil
+	case "-name":
+		a, err := arg()
+		if err != nil {
+			return nil, err
+		}
+		return nameExpr{pattern: a}, nil
+	case "-path", "-ipath":
+		a, err := arg()
+		if err != nil {
+			return nil, err
+		}
+		return pathExpr{pattern: a, fold: t == "-ipath"}, nil
+	case "-type":
+		a, err := arg()
+		if err != nil {
+			return nil, err
+		}
+		return newTypeExpr(a)
+	case "-size":
+		a, err := arg()
+		if err != nil {
+			return nil, err
+		}
+		return newSizeExpr(a)
+	default:
+		return nil, fmt.Errorf("unknown expression '%s'", t)
+	}
+}
@@ -0,0 +1,227 @@
+/*
+Copyright © 2022 Antonin Portelli <antonin.portelli@me.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package client
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func testResult(p string, dir bool, size uint64) SearchResult {
+	t := "FILE"
+	if dir {
+		t = "DIRECTORY"
+	}
+	return SearchResult{ObjectPath: p, ObjectName: p[strings.LastIndex(p, "/")+1:], ObjectType: t,
+		ObjectSize: size}
+}
+
+func TestParseExpression(t *testing.T) {
+	file := testResult("archive@p:/data/run1/out.h5", false, 2048)
+	dir := testResult("archive@p:/data/run1", true, 0)
+	tests := []struct {
+		expr     string
+		file     bool
+		dir      bool
+		exact    bool
+		pushdown bool
+	}{
+		{"", true, true, true, false},
+		{"-name *.h5", true, false, true, true},
+		{"-name out.h5", true, false, true, true},
+		{"-name *.nc", false, false, true, true},
+		{"-type d", false, true, true, true},
+		{"! -type d", true, false, true, true},
+		{"-not -name *.h5", false, true, false, false},
+		{"-name *.h5 -o -type d", true, true, true, true},
+		{"-name *.h5 -a -size +1k", true, false, false, true},
+		{"-name *.h5 -and -size -2k", false, false, false, true},
+		{"-size 2048", true, false, false, true},
+		{"-size 2k", true, false, false, true},
+		{"-size 2048c", true, false, false, true},
+		{"-path */run1/* -type f", true, false, false, true},
+		{"-ipath */RUN1", false, true, false, false},
+		{"( -name *.nc -o -name *.h5 ) -type f", true, false, true, true},
+		{"-type d -o ( -name *.h5 -size +1M )", false, true, false, true},
+	}
+	for _, tt := range tests {
+		e, err := ParseExpression(strings.Fields(tt.expr))
+		if err != nil {
+			t.Errorf("ParseExpression(%q): %s", tt.expr, err)
+			continue
+		}
+		if got := e.Match(file); got != tt.file {
+			t.Errorf("%q on file: got %v, want %v", tt.expr, got, tt.file)
+		}
+		if got := e.Match(dir); got != tt.dir {
+			t.Errorf("%q on directory: got %v, want %v", tt.expr, got, tt.dir)
+		}
+		crit, exact := e.pushdown()
+		if exact != tt.exact {
+			t.Errorf("%q: got exact %v, want %v", tt.expr, exact, tt.exact)
+		}
+		if (crit != nil) != tt.pushdown {
+			t.Errorf("%q: got criteria %v, want pushdown %v", tt.expr, crit, tt.pushdown)
+		}
+	}
+}
+
+func TestParseExpressionErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		err  string
+	}{
+		{"-name", "missing argument to '-name'"},
+		{"-type x", "unknown file type 'x'"},
+		{"-size 10X", "invalid size '10X'"},
+		{"-size +", "invalid size '+'"},
+		{"( -name a", "missing ')' in expression"},
+		{"-name a )", "unexpected ')' in expression"},
+		{"-name a -o", "unexpected end of expression"},
+		{"-mtime 1", "unknown expression '-mtime'"},
+	}
+	for _, tt := range tests {
+		_, err := ParseExpression(strings.Fields(tt.expr))
+		if err == nil || err.Error() != tt.err {
+			t.Errorf("ParseExpression(%q): got error %v, want %q", tt.expr, err, tt.err)
+		}
+	}
+}
+
+func TestNamePushdown(t *testing.T) {
+	tests := []struct {
+		pattern string
+		crit    any
+		exact   bool
+	}{
+		{"*.h5", FindRule{Type: "FILE_NAME", Value: ".h5", Operator: "ends with"}, true},
+		{"run*", FindRule{Type: "FILE_NAME", Value: "run", Operator: "starts with"}, true},
+		{"*run*", FindRule{Type: "FILE_NAME", Value: "run", Operator: "contains"}, true},
+		{"out.h5", FindRule{Type: "FILE_NAME", Value: "out.h5", Operator: "equal"}, true},
+		{"*run*.h5", FindCriteria{Condition: "AND", Rules: []any{
+			FindRule{Type: "FILE_NAME", Value: "run", Operator: "contains"},
+			FindRule{Type: "FILE_NAME", Value: ".h5", Operator: "ends with"},
+		}}, false},
+		{"r?n*", nil, false},
+		{"*", nil, true},
+	}
+	for _, tt := range tests {
+		crit, exact := nameExpr{pattern: tt.pattern}.pushdown()
+		if !reflect.DeepEqual(crit, tt.crit) || exact != tt.exact {
+			t.Errorf("nameExpr{%q}.pushdown(): got %+v, %v, want %+v, %v", tt.pattern, crit, exact,
+				tt.crit, tt.exact)
+		}
+	}
+}
+
+func TestAncestorExpr(t *testing.T) {
+	root := "archive@p:/data/tmp"
+	tests := []struct {
+		pattern string
+		path    string
+		self    bool
+		match   bool
+	}{
+		{"tmp", "archive@p:/data/tmp/a.h5", true, false},
+		{"tmp", "archive@p:/data/tmp/tmp", true, true},
+		{"tmp", "archive@p:/data/tmp/tmp", false, false},
+		{"tmp", "archive@p:/data/tmp/tmp/a.h5", false, true},
+		{"t*", "archive@p:/data/tmp/sub/test/a", true, true},
+		{"data", "archive@p:/data/tmp/sub", true, false},
+		{"*/data/tmp", "archive@p:/data/tmp/sub", true, false},
+		{"*/tmp/sub", "archive@p:/data/tmp/sub", true, true},
+		{"*/tmp/sub", "archive@p:/data/tmp/sub", false, false},
+		{"archive@p:/data/tmp/sub", "archive@p:/data/tmp/sub/x", false, true},
+		{"/data/tmp/sub", "archive@p:/data/tmp/sub/x", false, true},
+		{"tmp", root, true, false},
+	}
+	for _, tt := range tests {
+		e := ancestorExpr{pattern: tt.pattern, root: root, self: tt.self}
+		if got := e.Match(testResult(tt.path, false, 0)); got != tt.match {
+			t.Errorf("ancestorExpr{%q, self: %v} on %q: got %v, want %v", tt.pattern, tt.self, tt.path,
+				got, tt.match)
+		}
+	}
+}
+
+func TestPathExpr(t *testing.T) {
+	tests := []struct {
+		pattern string
+		fold    bool
+		match   bool
+	}{
+		{"archive@p:/data/*.h5", false, true},
+		{"/data/*.h5", false, true},
+		{"/DATA/*.H5", false, false},
+		{"/DATA/*.H5", true, true},
+		{"*/run1/*", false, true},
+		{"/run1/*", false, false},
+		{"data/*", false, false},
+	}
+	r := testResult("archive@p:/data/run1/out.h5", false, 0)
+	for _, tt := range tests {
+		e := pathExpr{pattern: tt.pattern, fold: tt.fold}
+		if got := e.Match(r); got != tt.match {
+			t.Errorf("pathExpr{%q, fold: %v} on %q: got %v, want %v", tt.pattern, tt.fold, r.ObjectPath,
+				got, tt.match)
+		}
+	}
+}
+
+func TestDepthExpr(t *testing.T) {
+	tests := []struct {
+		min, max int
+		path     string
+		match    bool
+	}{
+		{0, -1, "archive@p:/data", true},
+		{1, -1, "archive@p:/data", false},
+		{1, 1, "archive@p:/data/a", true},
+		{1, 1, "archive@p:/data/a/b", false},
+		{2, 3, "archive@p:/data/a/b/c", true},
+		{2, 3, "archive@p:/data/a/b/c/d", false},
+	}
+	for _, tt := range tests {
+		e := depthExpr{root: PathDepth("archive@p:/data"), min: tt.min, max: tt.max}
+		if got := e.Match(testResult(tt.path, false, 0)); got != tt.match {
+			t.Errorf("depthExpr{%d, %d} on %q: got %v, want %v", tt.min, tt.max, tt.path, got, tt.match)
+		}
+	}
+}
+
+func TestWithoutDepthRules(t *testing.T) {
+	name := FindRule{Type: "FILE_NAME", Value: "a", Operator: "equal"}
+	expr := andExpr{nameExpr{pattern: "a"}, depthExpr{root: 1, min: 1, max: 2}}
+	crit, _ := expr.pushdown()
+	s := newScan("archive@p:/data", expr, 10)
+	if !s.depth {
+		t.Fatalf("newScan(%+v): depth rules not detected in %+v", expr, crit)
+	}
+	if got := s.withoutDepth().req.Criteria; !reflect.DeepEqual(got,
+		FindCriteria{Condition: "AND", Rules: []any{name}}) {
+		t.Errorf("withoutDepth(): got %+v", got)
+	}
+	s = newScan("archive@p:/data", depthExpr{root: 1, min: 0, max: 1}, 10)
+	if got := s.withoutDepth().req.Criteria; !reflect.DeepEqual(got, matchAll()) {
+		t.Errorf("withoutDepth() of depth only: got %+v, want %+v", got, matchAll())
+	}
+	if s = newScan("archive@p:/data", nameExpr{pattern: "a"}, 10); s.depth {
+		t.Errorf("newScan(): unexpected depth rules in %+v", s.req.Criteria)
+	}
+}
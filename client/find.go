@@ -18,93 +18,176 @@ along with this program. If not, see <http://www.gnu.org/licenses/>.
 package client
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"net/url"
-	"strings"
+	"time"
 
-	"github.com/mitchellh/mapstructure"
+	log "github.com/aportelli/golog"
 )
 
 type FindOptions struct {
-	Path    string
-	Pattern string
-	Type    string
+	Path         string
+	Pattern      string
+	PathPattern  string
+	IPathPattern string
+	Type         string
+	Since        time.Time
+	Until        time.Time
+	Exclude      []string
+	Prune        []string
+	Repositories []int // only keep instances stored in these repositories, all if empty
+	MinDepth     int
+	MaxDepth     int       // unlimited if negative
+	Versions     string    // all, latest or first, default is all or latest if AsOf is set
+	AsOf         time.Time // only consider instances backed up at or before this date
+	Expr         Expr
+	Prefetch     int            // number of pages fetched ahead, DefaultPrefetch if not positive
+	Split        bool           // search subdirectories concurrently
+	Cursor       string         // resume the search from this page cursor
+	Selected     []SearchResult // instances selected before Cursor, see ResultIterator.Cursor
+	PageSize     int            // number of results per page, client default if not positive
+	Limit        int            // maximum number of results returned by Find, unlimited if not positive
+	Index        *Index         // search this local index instead of the server
 }
 
-// Find, meant to be used as a goroutine //////////////////////////////////////
-func (m *MiriaClient) Find(opt FindOptions, cout chan []SearchResult, cerr chan error) {
-	// form search request from pattern
-	var req FindInstanceRequest
-
-	req.RootObjectPath = opt.Path
-	req.ResultType = "INST"
-	req.PageSize = 3000
-	req.Criteria.Condition = "AND"
-	split := strings.Split(opt.Pattern, "*")
+const (
+	DefaultPageSize = 3000
+	DefaultPrefetch = 2
+)
 
-	addRule := func(t string, val any, op string) {
-		req.Criteria.Rules = append(req.Criteria.Rules, FindRule{
-			Type:     t,
-			Value:    val,
-			Value2:   nil,
-			Operator: op,
-		})
+// Combine all options into a single expression ///////////////////////////////
+func (opt FindOptions) expression() (Expr, error) {
+	var e andExpr
+	if opt.Pattern != "" {
+		e = append(e, nameExpr{pattern: opt.Pattern})
 	}
-
-	// parsing serach pattern
-	if opt.Pattern == "*" || opt.Pattern == "" {
-		// match everything
-		addRule("FILE_NAME", "", "contains")
-	} else if len(split) == 1 {
-		// no wildcard
-		addRule("FILE_NAME", split[0], "equal")
-	} else {
-		// first character is not a wildcard
-		if split[0] != "" {
-			addRule("FILE_NAME", split[0], "starts with")
+	if opt.PathPattern != "" {
+		e = append(e, pathExpr{pattern: opt.PathPattern})
+	}
+	if opt.IPathPattern != "" {
+		e = append(e, pathExpr{pattern: opt.IPathPattern, fold: true})
+	}
+	if opt.Type != "" {
+		t, err := newTypeExpr(opt.Type)
+		if err != nil {
+			return nil, err
 		}
-		// strings between wildcards
-		for _, s := range split[1 : len(split)-1] {
-			addRule("FILE_NAME", s, "contains")
+		e = append(e, t)
+	}
+	if !opt.Since.IsZero() || !opt.Until.IsZero() {
+		e = append(e, dateExpr{since: opt.Since, until: opt.Until})
+	}
+	if !opt.AsOf.IsZero() {
+		// backup dates have a one second resolution
+		e = append(e, dateExpr{until: opt.AsOf.Truncate(time.Second).Add(time.Second)})
+	}
+	for _, p := range opt.Exclude {
+		e = append(e, excludeExpr(p, opt.Path))
+	}
+	for _, p := range opt.Prune {
+		e = append(e, pruneExpr(p, opt.Path))
+	}
+	if len(opt.Repositories) > 0 {
+		e = append(e, repositoryExpr(opt.Repositories))
+	}
+	if opt.MinDepth > 0 || opt.MaxDepth >= 0 {
+		e = append(e, depthExpr{root: PathDepth(opt.Path), min: opt.MinDepth, max: opt.MaxDepth})
+	}
+	if opt.Expr != nil {
+		e = append(e, opt.Expr)
+	}
+	return e, nil
+}
+
+// Direct subdirectories of root, in order of appearance. Without depth rules,
+// this would scan the whole tree, so errNoDepthRules is returned as soon as
+// the server rejects or ignores them.
+func (m *MiriaClient) subdirectories(ctx context.Context, root string, pageSize int,
+	depth int) ([]string, error) {
+	var dirs []string
+
+	rootDepth := PathDepth(root)
+	s := newScan(root, andExpr{typeExpr{dir: true}, depthExpr{root: rootDepth, min: 1, max: 1}}, pageSize)
+	s.strict = true
+	seen := make(map[string]bool)
+	for p := range m.fetchPages(ctx, s, "", depth) {
+		if p.err != nil {
+			return nil, p.err
 		}
-		// last character is not a wildcard
-		if split[len(split)-1] != "" {
-			addRule("FILE_NAME", split[len(split)-1], "ends with")
+		for _, r := range p.results {
+			if !seen[r.ObjectPath] {
+				seen[r.ObjectPath] = true
+				dirs = append(dirs, r.ObjectPath)
+			}
 		}
 	}
+	return dirs, ctx.Err()
+}
 
-	// adding rule for type filtering
-	if opt.Type != "" {
-		if opt.Type == "f" {
-			addRule("FILE_TYPE", 1, "equals to")
-		} else if opt.Type == "d" {
-			addRule("FILE_TYPE", []int{2, 3}, "in")
-		} else {
-			cerr <- fmt.Errorf("unknown file type '%s'", opt.Type)
-			return
+// Version selection mode, after resolving the default
+func (opt FindOptions) versions() string {
+	if opt.Versions == "" {
+		if !opt.AsOf.IsZero() {
+			return VersionsLatest
 		}
+		return VersionsAll
 	}
+	return opt.Versions
+}
 
-	// execute request
-	var searchResp SearchResponse
-	resp, err := m.Post("/files/advanced-search/", req, true)
+// Execute requests, splitting the search in subtrees if requested
+func (m *MiriaClient) pages(ctx context.Context, opt FindOptions) (<-chan page, error) {
+	expr, err := opt.expression()
 	if err != nil {
-		cerr <- err
-		return
-	}
-	mapstructure.Decode(resp, &searchResp)
-	cout <- searchResp.Results
-	nextPage := resp["nextPage"]
-	for nextPage != nil {
-		nextPageEnc := url.QueryEscape(nextPage.(string))
-		resp, err := m.Post("/files/advanced-search/?page="+nextPageEnc, req, true)
-		if err != nil {
-			cerr <- err
-			return
+		return nil, err
+	}
+	prefetch := opt.Prefetch
+	if prefetch <= 0 {
+		prefetch = DefaultPrefetch
+	}
+	pageSize := opt.PageSize
+	if pageSize <= 0 {
+		pageSize = m.pageSize
+	}
+	if opt.Index != nil {
+		if opt.Cursor != "" {
+			return nil, fmt.Errorf("an index search cannot be resumed from a cursor")
+		}
+		return opt.Index.pages(ctx, opt.Path, expr, pageSize), nil
+	}
+	if opt.Split && m.concurrency > 1 && (opt.MaxDepth < 0 || opt.MaxDepth >= 2) {
+		if opt.Cursor != "" {
+			return nil, fmt.Errorf("a split search cannot be resumed from a cursor")
+		}
+		// the subtrees are only separated by depth rules, without them the
+		// search is not split
+		dirs, err := m.subdirectories(ctx, opt.Path, pageSize, prefetch)
+		switch {
+		case errors.Is(err, errNoDepthRules):
+			log.Inf.Println("the server does not support depth criteria, the search is not split")
+		case err != nil:
+			return nil, err
+		default:
+			rootDepth := PathDepth(opt.Path)
+			scans := []scan{newScan(opt.Path, andExpr{expr, depthExpr{root: rootDepth, min: 0, max: 1}},
+				pageSize)}
+			for _, d := range dirs {
+				scans = append(scans, newScan(d, andExpr{expr, depthExpr{root: rootDepth, min: 2, max: -1}},
+					pageSize))
+			}
+			return m.fetchScans(ctx, scans, prefetch, m.concurrency), nil
 		}
-		mapstructure.Decode(resp, &searchResp)
-		cout <- searchResp.Results
-		nextPage = resp["nextPage"]
 	}
-	cout <- nil
+	s := newScan(opt.Path, expr, pageSize)
+	if opt.Limit > 0 && opt.Limit < pageSize && s.exact && opt.versions() == VersionsAll {
+		// all results are kept, a single page is enough
+		s.req.PageSize = opt.Limit
+	}
+	return m.fetchPages(ctx, s, opt.Cursor, prefetch), nil
+}
+
+// Instance selector for the options, nil if all instances are kept
+func (opt FindOptions) VersionSelector() (*VersionSelector, error) {
+	return NewVersionSelector(opt.versions())
 }
@@ -0,0 +1,128 @@
+/*
+Copyright © 2022 Antonin Portelli <antonin.portelli@me.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package client
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// Shell pattern matching similar to fnmatch(3) without FNM_PATHNAME, i.e. '*'
+// also matches '/'. Supports '*', '?', '[...]' classes and '\' escapes.
+func MatchGlob(pattern string, name string, fold bool) bool {
+	if fold {
+		pattern = strings.ToLower(pattern)
+		name = strings.ToLower(name)
+	}
+	return matchGlob(pattern, name)
+}
+
+func matchGlob(pattern string, name string) bool {
+	// backtracking on the last star only is enough for glob patterns
+	starP, starN := -1, -1
+	p, n := 0, 0
+	for n < len(name) {
+		if p < len(pattern) {
+			switch pattern[p] {
+			case '*':
+				starP, starN = p, n
+				p++
+				continue
+			case '?':
+				_, w := utf8.DecodeRuneInString(name[n:])
+				p++
+				n += w
+				continue
+			case '[':
+				r, w := utf8.DecodeRuneInString(name[n:])
+				if ok, end := matchClass(pattern[p:], r); end > 0 {
+					if ok {
+						p += end
+						n += w
+						continue
+					}
+				} else if name[n] == '[' {
+					// unterminated class, '[' is literal
+					p++
+					n++
+					continue
+				}
+			case '\\':
+				if p+1 < len(pattern) && pattern[p+1] == name[n] {
+					p += 2
+					n++
+					continue
+				}
+			default:
+				if pattern[p] == name[n] {
+					p++
+					n++
+					continue
+				}
+			}
+		}
+		if starP < 0 {
+			return false
+		}
+		_, w := utf8.DecodeRuneInString(name[starN:])
+		starN += w
+		p, n = starP+1, starN
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+// Match rune against the class at the start of pattern, end is the length of
+// the class in pattern or 0 if the class is not terminated
+func matchClass(pattern string, r rune) (ok bool, end int) {
+	i := 1
+	negate := false
+	if i < len(pattern) && (pattern[i] == '!' || pattern[i] == '^') {
+		negate = true
+		i++
+	}
+	first := true
+	for i < len(pattern) {
+		if pattern[i] == ']' && !first {
+			return ok != negate, i + 1
+		}
+		first = false
+		lo, w := utf8.DecodeRuneInString(pattern[i:])
+		if lo == '\\' && i+w < len(pattern) {
+			i += w
+			lo, w = utf8.DecodeRuneInString(pattern[i:])
+		}
+		i += w
+		hi := lo
+		if i+1 < len(pattern) && pattern[i] == '-' && pattern[i+1] != ']' {
+			hi, w = utf8.DecodeRuneInString(pattern[i+1:])
+			i += 1 + w
+		}
+		if lo <= r && r <= hi {
+			ok = true
+		}
+	}
+	return false, 0
+}
+
+// Whether the pattern contains glob meta-characters
+func hasMeta(pattern string) bool {
+	return strings.ContainsAny(pattern, "*?[\\")
+}
@@ -0,0 +1,55 @@
+/*
+Copyright © 2022 Antonin Portelli <antonin.portelli@me.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package client
+
+import "testing"
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		fold    bool
+		match   bool
+	}{
+		{"*", "", false, true},
+		{"*", "a/b", false, true},
+		{"*.h5", "out.h5", false, true},
+		{"*.h5", "out.h5.bak", false, false},
+		{"*.H5", "out.h5", false, false},
+		{"*.H5", "out.h5", true, true},
+		{"a*b*c", "aXbYbZc", false, true},
+		{"a*b*c", "aXcYb", false, false},
+		{"?.nc", "a.nc", false, true},
+		{"?.nc", "ab.nc", false, false},
+		{"run[0-9]", "run7", false, true},
+		{"run[0-9]", "runx", false, false},
+		{"run[!0-9]", "runx", false, true},
+		{"run[^0-9]", "run1", false, false},
+		{"[]a]", "]", false, true},
+		{"\\*", "*", false, true},
+		{"\\*", "a", false, false},
+		{"*/tmp/*", "archive@p:/a/tmp/b", false, true},
+		{"é?", "éà", false, true},
+	}
+	for _, tt := range tests {
+		if got := MatchGlob(tt.pattern, tt.name, tt.fold); got != tt.match {
+			t.Errorf("MatchGlob(%q, %q, %v): got %v, want %v", tt.pattern, tt.name, tt.fold, got,
+				tt.match)
+		}
+	}
+}
@@ -19,30 +19,57 @@ package client
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
-	"fmt"
 	"net/http"
 
 	log "github.com/aportelli/golog"
 )
 
+// Private method to get the access token, the token is only checked once, or
+// again if recheck is true
+func (m *MiriaClient) accessToken(recheck bool) (string, error) {
+	m.authMutex.Lock()
+	defer m.authMutex.Unlock()
+	if !m.authChecked || recheck {
+		levelCopy := log.AtMostLevel(0)
+		err := m.CheckAuthentication()
+		log.Level = levelCopy
+		if err != nil {
+			return "", err
+		}
+	}
+	return m.auth.Access, nil
+}
+
 // Private method to handle abstract requests /////////////////////////////////
 func (m *MiriaClient) executeRequest(request *http.Request, authenticate bool) (map[string]any, error) {
+	raw, status, err := m.doRequest(request, authenticate, false)
+	if authenticate && status == http.StatusUnauthorized && request.GetBody != nil {
+		// the token might have expired since it was checked, check and retry
+		request.Body, err = request.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		raw, _, err = m.doRequest(request, authenticate, true)
+	}
+	return raw, err
+}
+
+func (m *MiriaClient) doRequest(request *http.Request, authenticate bool, recheck bool) (map[string]any, int, error) {
 	// error if host is empty
 	if m.host == "" {
-		return nil, fmt.Errorf("host empty, please configure a host with `miria config set host <host>`")
+		return nil, 0, ErrNoHost
 	}
 
 	// complete request
 	request.Header.Set("Content-Type", "application/json")
 	if authenticate {
-		levelCopy := log.AtMostLevel(0)
-		err := m.CheckAuthentication()
-		log.Level = levelCopy
+		access, err := m.accessToken(recheck)
 		if err != nil {
-			return nil, err
+			return nil, 0, err
 		}
-		request.Header.Add("Authorization", "Bearer "+m.auth.Access)
+		request.Header.Set("Authorization", "Bearer "+access)
 	}
 	if log.Level >= 2 {
 		log.Dbg.Println("* Request headers")
@@ -65,33 +92,43 @@ func (m *MiriaClient) executeRequest(request *http.Request, authenticate bool) (
 	// execute request
 	var raw map[string]any
 
+	select {
+	case m.requests <- struct{}{}:
+	case <-request.Context().Done():
+		return nil, 0, request.Context().Err()
+	}
+	defer func() { <-m.requests }()
 	response, err := http.DefaultClient.Do(request)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	defer response.Body.Close()
 	dec := json.NewDecoder(response.Body)
 	err = dec.Decode(&raw)
 	if response.StatusCode >= 400 {
-		return raw, fmt.Errorf("the Miria server returned HTTP response %d", response.StatusCode)
+		return raw, response.StatusCode, &HTTPError{StatusCode: response.StatusCode, Response: raw}
 	}
 	if err != nil {
-		return nil, err
+		return nil, response.StatusCode, &DecodeError{Err: err}
 	}
 	if _, ok := raw["error"]; ok {
-		message, _ := json.MarshalIndent(raw, "", "  ")
-		return nil, fmt.Errorf("the Miria server returned an error\n%s", string(message))
+		return nil, response.StatusCode, &ServerError{Response: raw}
 	}
-	return raw, nil
+	return raw, response.StatusCode, nil
 }
 
 // POST ///////////////////////////////////////////////////////////////////////
 func (m *MiriaClient) Post(path string, body any, authenticate bool) (map[string]any, error) {
+	return m.PostContext(context.Background(), path, body, authenticate)
+}
+
+func (m *MiriaClient) PostContext(ctx context.Context, path string, body any,
+	authenticate bool) (map[string]any, error) {
 	jbuf, err := json.Marshal(body)
 	if err != nil {
 		return nil, err
 	}
-	request, err := http.NewRequest("POST", m.apiUrl+path, bytes.NewBuffer(jbuf))
+	request, err := http.NewRequestWithContext(ctx, "POST", m.apiUrl+path, bytes.NewBuffer(jbuf))
 	if err != nil {
 		return nil, err
 	}
@@ -106,7 +143,11 @@ func (m *MiriaClient) Post(path string, body any, authenticate bool) (map[string
 
 // GET ////////////////////////////////////////////////////////////////////////
 func (m *MiriaClient) Get(path string, authenticate bool) (map[string]any, error) {
-	request, err := http.NewRequest("GET", m.apiUrl+path, nil)
+	return m.GetContext(context.Background(), path, authenticate)
+}
+
+func (m *MiriaClient) GetContext(ctx context.Context, path string, authenticate bool) (map[string]any, error) {
+	request, err := http.NewRequestWithContext(ctx, "GET", m.apiUrl+path, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,550 @@
+/*
+Copyright © 2022 Antonin Portelli <antonin.portelli@me.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package client
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// Local index of the instances under a root path of a host, stored in a
+// SQLite database of the cache directory to answer searches without querying
+// the server. Instances are indexed by path, parent directory and name, so
+// that searches only read the instances under the searched path, or with the
+// searched name. An index with an empty root covers all the indexed paths of
+// the host.
+type Index struct {
+	IndexHeader
+	db *sql.DB
+}
+
+// Index metadata
+type IndexHeader struct {
+	Host      string
+	Root      string
+	Built     time.Time
+	Refreshed time.Time
+	Count     int
+}
+
+// Returned when no index contains the searched path
+var ErrNoIndex = errors.New("no index found")
+
+// Database ///////////////////////////////////////////////////////////////////
+func IndexDir() (string, error) {
+	cacheDir, err := AppCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return cacheDir + "/index", nil
+}
+
+// One database per host, with the indexed roots and their instances. Indexed
+// roots do not overlap: building an index replaces the indexes below its root,
+// and building it below an indexed root updates this part of the index.
+const indexSchema = `
+CREATE TABLE IF NOT EXISTS roots (
+	root      TEXT PRIMARY KEY,
+	built     INTEGER NOT NULL,
+	refreshed INTEGER NOT NULL,
+	count     INTEGER NOT NULL
+);
+CREATE TABLE IF NOT EXISTS instances (
+	key           TEXT PRIMARY KEY,
+	path          TEXT NOT NULL,
+	parent        TEXT NOT NULL,
+	name          TEXT NOT NULL,
+	depth         INTEGER NOT NULL,
+	backup_date   TEXT NOT NULL,
+	backup_time   INTEGER NOT NULL,
+	instance_id   INTEGER NOT NULL,
+	object_id     INTEGER NOT NULL,
+	size          INTEGER NOT NULL,
+	type          TEXT NOT NULL,
+	repository_id INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS instances_path ON instances (path);
+CREATE INDEX IF NOT EXISTS instances_parent ON instances (parent);
+CREATE INDEX IF NOT EXISTS instances_name ON instances (name);
+`
+
+func (m *MiriaClient) openIndexDB() (*sql.DB, error) {
+	dir, err := IndexDir()
+	if err != nil {
+		return nil, err
+	}
+	err = os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256([]byte(m.host))
+	file := dir + "/" + hex.EncodeToString(sum[:16]) + ".db"
+	db, err := sql.Open("sqlite", "file:"+file+"?_pragma=busy_timeout(10000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, err
+	}
+	// a single connection, so that a scan and its writes do not lock each other
+	db.SetMaxOpenConns(1)
+	_, err = db.Exec(indexSchema)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("cannot open index database '%s': %s", file, err.Error())
+	}
+	return db, nil
+}
+
+// Paths under root, as a condition on the path column and its arguments
+func underPathSQL(root string) (string, []any) {
+	prefix := strings.TrimSuffix(root, "/") + "/"
+	// '0' follows '/', so the range holds all the paths starting with prefix
+	return "(path = ? OR (path >= ? AND path < ?))",
+		[]any{root, prefix, prefix[:len(prefix)-1] + "0"}
+}
+
+func scanHeader(rows interface{ Scan(...any) error }, host string) (IndexHeader, error) {
+	var h IndexHeader
+	var built, refreshed int64
+
+	err := rows.Scan(&h.Root, &built, &refreshed, &h.Count)
+	h.Host = host
+	h.Built, h.Refreshed = time.Unix(built, 0), time.Unix(refreshed, 0)
+	return h, err
+}
+
+// Load and list //////////////////////////////////////////////////////////////
+// Load the index containing p, built on p or one of its ancestors from the
+// configured host, or all the indexes of the host if p is empty
+func (m *MiriaClient) LoadIndex(p string) (*Index, error) {
+	db, err := m.openIndexDB()
+	if err != nil {
+		return nil, err
+	}
+	if p == "" {
+		var n int
+		var built, refreshed int64
+
+		idx := &Index{IndexHeader: IndexHeader{Host: m.host}, db: db}
+		err = db.QueryRow(`SELECT COUNT(*), COALESCE(SUM(count), 0), COALESCE(MIN(built), 0),
+			COALESCE(MIN(refreshed), 0) FROM roots`).Scan(&n, &idx.Count, &built, &refreshed)
+		if err == nil && n == 0 {
+			err = fmt.Errorf("%w, build one with `miria index build`", ErrNoIndex)
+		}
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+		idx.Built, idx.Refreshed = time.Unix(built, 0), time.Unix(refreshed, 0)
+		return idx, nil
+	}
+	orig := p
+	p = CleanObjectPath(p)
+	for {
+		row := db.QueryRow("SELECT root, built, refreshed, count FROM roots WHERE root = ?", p)
+		h, err := scanHeader(row, m.host)
+		if err == nil {
+			return &Index{IndexHeader: h, db: db}, nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			db.Close()
+			return nil, err
+		}
+		parent := ParentPath(p)
+		if parent == p {
+			db.Close()
+			return nil, fmt.Errorf("%w for '%s', build one with `miria index build`", ErrNoIndex, orig)
+		}
+		p = parent
+	}
+}
+
+// Headers of all saved indexes of the configured host
+func (m *MiriaClient) ListIndexes() ([]IndexHeader, error) {
+	var headers []IndexHeader
+
+	db, err := m.openIndexDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	rows, err := db.Query("SELECT root, built, refreshed, count FROM roots ORDER BY root")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		h, err := scanHeader(rows, m.host)
+		if err != nil {
+			return nil, err
+		}
+		headers = append(headers, h)
+	}
+	return headers, rows.Err()
+}
+
+// Close the index database
+func (idx *Index) Close() error {
+	return idx.db.Close()
+}
+
+// Build and refresh //////////////////////////////////////////////////////////
+// Instance key, the path and date are used if the server does not provide an ID
+func instanceKey(r SearchResult) string {
+	if r.InstanceId != 0 {
+		return "i" + strconv.Itoa(r.InstanceId)
+	}
+	return "p" + r.ObjectPath + "\x00" + r.InstanceBackupDate
+}
+
+// Insert the instances under root into the database within a transaction,
+// instances already indexed are skipped. Returns the number of new instances.
+func (m *MiriaClient) insertInstances(ctx context.Context, tx *sql.Tx, opt FindOptions) (int, error) {
+	stmt, err := tx.PrepareContext(ctx, `INSERT OR IGNORE INTO instances (key, path, parent, name,
+		depth, backup_date, backup_time, instance_id, object_id, size, type, repository_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+	added := 0
+	pages := m.FindPages(ctx, opt)
+	defer pages.Close()
+	for pages.Next() {
+		for _, r := range pages.Page() {
+			var t int64
+			if bt := r.BackupTime(); !bt.IsZero() {
+				t = bt.Unix()
+			}
+			res, err := stmt.ExecContext(ctx, instanceKey(r), r.ObjectPath, ParentPath(r.ObjectPath),
+				r.ObjectName, PathDepth(r.ObjectPath), r.InstanceBackupDate, t, r.InstanceId, r.ObjectId,
+				int64(r.ObjectSize), r.ObjectType, r.RepositoryId)
+			if err != nil {
+				return 0, err
+			}
+			n, _ := res.RowsAffected()
+			added += int(n)
+		}
+	}
+	return added, pages.Err()
+}
+
+// Update the instance count of the indexed roots containing root or below it
+func updateCounts(ctx context.Context, tx *sql.Tx, root string) error {
+	rows, err := tx.QueryContext(ctx, "SELECT root FROM roots")
+	if err != nil {
+		return err
+	}
+	var roots []string
+	for rows.Next() {
+		var r string
+		if err = rows.Scan(&r); err != nil {
+			rows.Close()
+			return err
+		}
+		if UnderPath(root, r) || UnderPath(r, root) {
+			roots = append(roots, r)
+		}
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	for _, r := range roots {
+		cond, args := underPathSQL(r)
+		_, err = tx.ExecContext(ctx, "UPDATE roots SET count = (SELECT COUNT(*) FROM instances WHERE "+
+			cond+") WHERE root = ?", append(args, r)...)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Indexed root strictly above root, or an empty string if there is none
+func enclosingRoot(ctx context.Context, tx *sql.Tx, root string) (string, error) {
+	for p := ParentPath(root); p != root; root, p = p, ParentPath(p) {
+		var r string
+		err := tx.QueryRowContext(ctx, "SELECT root FROM roots WHERE root = ?", p).Scan(&r)
+		if err == nil {
+			return r, nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return "", err
+		}
+	}
+	return "", nil
+}
+
+// Build index of all instances under opt.Path, only the page size, prefetch
+// and split options are used. The previous instances under the path, and the
+// indexes below it, are replaced once the scan is complete. If the path is
+// below an indexed root, this part of its index is replaced instead, and the
+// enclosing index is returned.
+func (m *MiriaClient) BuildIndex(ctx context.Context, opt FindOptions) (*Index, error) {
+	db, err := m.openIndexDB()
+	if err != nil {
+		return nil, err
+	}
+	idx := &Index{IndexHeader: IndexHeader{Host: m.host, Root: CleanObjectPath(opt.Path),
+		Built: time.Now()}, db: db}
+	idx.Refreshed = idx.Built
+	err = idx.update(ctx, func(tx *sql.Tx) error {
+		cond, args := underPathSQL(idx.Root)
+		_, err := tx.ExecContext(ctx, "DELETE FROM instances WHERE "+cond, args...)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, "DELETE FROM roots WHERE "+strings.Replace(cond, "path", "root", -1),
+			args...)
+		if err != nil {
+			return err
+		}
+		scan := FindOptions{Path: idx.Root, MaxDepth: -1, Versions: VersionsAll, PageSize: opt.PageSize,
+			Prefetch: opt.Prefetch, Split: opt.Split}
+		idx.Count, err = m.insertInstances(ctx, tx, scan)
+		if err != nil {
+			return err
+		}
+		enclosing, err := enclosingRoot(ctx, tx, idx.Root)
+		if err != nil {
+			return err
+		}
+		if enclosing == "" {
+			_, err = tx.ExecContext(ctx, "INSERT INTO roots (root, built, refreshed, count) VALUES (?, ?, ?, ?)",
+				idx.Root, idx.Built.Unix(), idx.Refreshed.Unix(), idx.Count)
+			if err != nil {
+				return err
+			}
+		}
+		err = updateCounts(ctx, tx, idx.Root)
+		if err != nil || enclosing == "" {
+			return err
+		}
+		// the part of the enclosing index is updated, which is returned
+		row := tx.QueryRowContext(ctx, "SELECT root, built, refreshed, count FROM roots WHERE root = ?",
+			enclosing)
+		idx.IndexHeader, err = scanHeader(row, m.host)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return idx, nil
+}
+
+// Run f in a transaction, committed if f succeeds
+func (idx *Index) update(ctx context.Context, f func(tx *sql.Tx) error) error {
+	tx, err := idx.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	err = f(tx)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// Add instances backed up since the latest one in the index, returns the
+// number of new instances. Instances removed from the archive are not detected.
+func (m *MiriaClient) RefreshIndex(ctx context.Context, idx *Index, opt FindOptions) (int, error) {
+	var added int
+
+	if idx.Root == "" {
+		return 0, fmt.Errorf("indexes must be refreshed one at a time")
+	}
+	refreshed := time.Now()
+	err := idx.update(ctx, func(tx *sql.Tx) error {
+		var since int64
+
+		cond, args := underPathSQL(idx.Root)
+		err := tx.QueryRowContext(ctx, "SELECT COALESCE(MAX(backup_time), 0) FROM instances WHERE "+cond,
+			args...).Scan(&since)
+		if err != nil {
+			return err
+		}
+		scan := FindOptions{Path: idx.Root, MaxDepth: -1, Versions: VersionsAll, PageSize: opt.PageSize,
+			Prefetch: opt.Prefetch, Split: opt.Split}
+		if since > 0 {
+			scan.Since = time.Unix(since, 0)
+		}
+		added, err = m.insertInstances(ctx, tx, scan)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, "UPDATE roots SET refreshed = ? WHERE root = ?", refreshed.Unix(),
+			idx.Root)
+		if err != nil {
+			return err
+		}
+		err = updateCounts(ctx, tx, idx.Root)
+		if err != nil {
+			return err
+		}
+		return tx.QueryRowContext(ctx, "SELECT count FROM roots WHERE root = ?", idx.Root).Scan(&idx.Count)
+	})
+	if err != nil {
+		return 0, err
+	}
+	idx.Refreshed = refreshed
+	return added, nil
+}
+
+// Search /////////////////////////////////////////////////////////////////////
+// SQLite GLOB pattern matching a superset of the names matching the
+// expression, empty if any name can match
+func indexNameGlob(e Expr) string {
+	switch e := e.(type) {
+	case nameExpr:
+		// GLOB has no escapes and uses '^' for negated sets
+		if e.pattern != "" && !strings.ContainsAny(e.pattern, "\\[") {
+			return e.pattern
+		}
+	case andExpr:
+		for _, c := range e {
+			if glob := indexNameGlob(c); glob != "" {
+				return glob
+			}
+		}
+	}
+	return ""
+}
+
+// Depth bounds of the expression, max is unlimited if negative
+func indexDepth(e Expr) (min int, max int) {
+	max = -1
+	switch e := e.(type) {
+	case depthExpr:
+		min = e.root + e.min
+		if e.max >= 0 {
+			max = e.root + e.max
+		}
+	case andExpr:
+		for _, c := range e {
+			cmin, cmax := indexDepth(c)
+			if cmin > min {
+				min = cmin
+			}
+			if cmax >= 0 && (max < 0 || cmax < max) {
+				max = cmax
+			}
+		}
+	}
+	return min, max
+}
+
+// Query of the indexed instances under root that can match expr
+func (idx *Index) query(root string, expr Expr) (string, []any) {
+	var conds []string
+	var args []any
+
+	min, max := indexDepth(expr)
+	if root != "" {
+		root = CleanObjectPath(root)
+		if min == PathDepth(root)+1 && max == min {
+			// direct children
+			conds = append(conds, "parent = ?")
+			args = append(args, root)
+		} else {
+			cond, condArgs := underPathSQL(root)
+			conds = append(conds, cond)
+			args = append(args, condArgs...)
+		}
+	}
+	if idx.Root != "" && (root == "" || !UnderPath(root, idx.Root)) {
+		cond, condArgs := underPathSQL(idx.Root)
+		conds = append(conds, cond)
+		args = append(args, condArgs...)
+	}
+	if min > 0 {
+		conds = append(conds, "depth >= ?")
+		args = append(args, min)
+	}
+	if max >= 0 {
+		conds = append(conds, "depth <= ?")
+		args = append(args, max)
+	}
+	if glob := indexNameGlob(expr); glob != "" {
+		conds = append(conds, "name GLOB ?")
+		args = append(args, glob)
+	}
+	q := `SELECT path, name, backup_date, instance_id, object_id, size, type, repository_id
+		FROM instances`
+	if len(conds) > 0 {
+		q += " WHERE " + strings.Join(conds, " AND ")
+	}
+	return q + " ORDER BY path, backup_time", args
+}
+
+// Pages of indexed results under root (or anywhere in the index if root is
+// empty) matching expr, they cannot be resumed from a cursor
+func (idx *Index) pages(ctx context.Context, root string, expr Expr, pageSize int) <-chan page {
+	pages := make(chan page)
+	go func() {
+		defer close(pages)
+		q, args := idx.query(root, expr)
+		rows, err := idx.db.QueryContext(ctx, q, args...)
+		if err != nil {
+			sendPage(ctx, pages, page{err: err})
+			return
+		}
+		defer rows.Close()
+		var results []SearchResult
+		for rows.Next() {
+			var r SearchResult
+			var size int64
+
+			err = rows.Scan(&r.ObjectPath, &r.ObjectName, &r.InstanceBackupDate, &r.InstanceId, &r.ObjectId,
+				&size, &r.ObjectType, &r.RepositoryId)
+			if err != nil {
+				sendPage(ctx, pages, page{err: err})
+				return
+			}
+			r.ObjectSize = uint64(size)
+			if !expr.Match(r) {
+				continue
+			}
+			results = append(results, r)
+			if len(results) == pageSize {
+				if !sendPage(ctx, pages, page{results: results}) {
+					return
+				}
+				results = nil
+			}
+		}
+		if err = rows.Err(); err != nil {
+			sendPage(ctx, pages, page{err: err})
+			return
+		}
+		if len(results) > 0 {
+			sendPage(ctx, pages, page{results: results})
+		}
+	}()
+	return pages
+}
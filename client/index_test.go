@@ -0,0 +1,183 @@
+/*
+Copyright © 2022 Antonin Portelli <antonin.portelli@me.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package client
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// Client of a mock server listing tree, with indexes in a temporary cache
+// directory
+func newTestIndexClient(t *testing.T, tree *[]SearchResult) *MiriaClient {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	m, _ := newTestClient(t, func(body string, cursor string) (int, any) {
+		return testListing(*tree, 2)(body, cursor)
+	})
+	return m
+}
+
+// Paths of the results of an index search
+func testIndexSearch(t *testing.T, m *MiriaClient, root string, opt FindOptions) []string {
+	idx, err := m.LoadIndex(root)
+	if err != nil {
+		t.Fatalf("LoadIndex(%q): %s", root, err)
+	}
+	defer idx.Close()
+	opt.Index = idx
+	return testResults(t, m.Find(context.Background(), opt))
+}
+
+func TestIndexSearch(t *testing.T) {
+	tree := append([]SearchResult{}, testTree...)
+	m := newTestIndexClient(t, &tree)
+	idx, err := m.BuildIndex(context.Background(), FindOptions{Path: "archive@p:/data"})
+	if err != nil {
+		t.Fatalf("BuildIndex: %s", err)
+	}
+	idx.Close()
+	if idx.Count != len(testTree) {
+		t.Errorf("got %d indexed instances, want %d", idx.Count, len(testTree))
+	}
+	tests := []struct {
+		opt  FindOptions
+		want string
+	}{
+		{FindOptions{Path: "archive@p:/data/a", MaxDepth: -1},
+			"archive@p:/data/a archive@p:/data/a/x.h5 archive@p:/data/a/y.h5"},
+		{FindOptions{Path: "archive@p:/data", MinDepth: 1, MaxDepth: 1},
+			"archive@p:/data/a archive@p:/data/b archive@p:/data/c.h5"},
+		{FindOptions{Path: "archive@p:/data", MaxDepth: -1, Pattern: "?.h5"},
+			"archive@p:/data/a/x.h5 archive@p:/data/a/y.h5 archive@p:/data/b/z.h5 archive@p:/data/c.h5"},
+		{FindOptions{Path: "archive@p:/data", MaxDepth: -1, Pattern: "[xz].h5"},
+			"archive@p:/data/a/x.h5 archive@p:/data/b/z.h5"},
+		{FindOptions{Path: "archive@p:/data/b", MaxDepth: -1, Type: "f"}, "archive@p:/data/b/z.h5"},
+		// the parent of the root is only searched within the index
+		{FindOptions{Path: "archive@p:/", MinDepth: 1, MaxDepth: 1}, "archive@p:/data"},
+	}
+	for _, tt := range tests {
+		got := testIndexSearch(t, m, "archive@p:/data", tt.opt)
+		if strings.Join(got, " ") != tt.want {
+			t.Errorf("%+v: got %v, want %v", tt.opt, got, tt.want)
+		}
+	}
+	if _, err := m.LoadIndex("archive@p:/other"); !errors.Is(err, ErrNoIndex) {
+		t.Errorf("LoadIndex of an unindexed path: got error %v, want %v", err, ErrNoIndex)
+	}
+}
+
+func TestIndexRoots(t *testing.T) {
+	tree := append([]SearchResult{}, testTree...)
+	tree = append(tree, testResult("archive@q:/other", true, 0), testResult("archive@q:/other/w.h5", false, 16))
+	m := newTestIndexClient(t, &tree)
+	for _, root := range []string{"archive@p:/data/a", "archive@q:/other", "archive@p:/data/b"} {
+		idx, err := m.BuildIndex(context.Background(), FindOptions{Path: root})
+		if err != nil {
+			t.Fatalf("BuildIndex(%q): %s", root, err)
+		}
+		idx.Close()
+	}
+	// all indexes are searched without a path
+	got := testIndexSearch(t, m, "", FindOptions{MaxDepth: -1, Pattern: "*.h5"})
+	want := "archive@p:/data/a/x.h5 archive@p:/data/a/y.h5 archive@p:/data/b/z.h5 archive@q:/other/w.h5"
+	if strings.Join(got, " ") != want {
+		t.Errorf("all indexes: got %v, want %v", got, want)
+	}
+
+	// an index of the parent replaces the indexes below it
+	idx, err := m.BuildIndex(context.Background(), FindOptions{Path: "archive@p:/data"})
+	if err != nil {
+		t.Fatalf("BuildIndex: %s", err)
+	}
+	idx.Close()
+	headers, err := m.ListIndexes()
+	if err != nil {
+		t.Fatalf("ListIndexes: %s", err)
+	}
+	var roots []string
+	for _, h := range headers {
+		roots = append(roots, h.Root)
+	}
+	if strings.Join(roots, " ") != "archive@p:/data archive@q:/other" || headers[0].Count != len(testTree) {
+		t.Errorf("got indexes %v with %d instances, want [archive@p:/data archive@q:/other] with %d", roots,
+			headers[0].Count, len(testTree))
+	}
+
+	// an index below an indexed root updates it
+	tree = append(tree, testResult("archive@p:/data/a/n.h5", false, 32))
+	idx, err = m.BuildIndex(context.Background(), FindOptions{Path: "archive@p:/data/a"})
+	if err != nil {
+		t.Fatalf("BuildIndex: %s", err)
+	}
+	idx.Close()
+	if idx.Root != "archive@p:/data" || idx.Count != len(testTree)+1 {
+		t.Errorf("BuildIndex below a root: got index of %s with %d instances, want archive@p:/data with %d",
+			idx.Root, idx.Count, len(testTree)+1)
+	}
+	headers, err = m.ListIndexes()
+	if err != nil {
+		t.Fatalf("ListIndexes: %s", err)
+	}
+	roots = nil
+	for _, h := range headers {
+		roots = append(roots, h.Root)
+	}
+	if strings.Join(roots, " ") != "archive@p:/data archive@q:/other" || headers[0].Count != len(testTree)+1 {
+		t.Errorf("got indexes %v with %d instances, want [archive@p:/data archive@q:/other] with %d", roots,
+			headers[0].Count, len(testTree)+1)
+	}
+	idx, err = m.LoadIndex("archive@p:/data/b")
+	if err != nil {
+		t.Fatalf("LoadIndex: %s", err)
+	}
+	defer idx.Close()
+	if idx.Root != "archive@p:/data" || idx.Count != len(testTree)+1 {
+		t.Errorf("got index of %s with %d instances, want archive@p:/data with %d", idx.Root, idx.Count,
+			len(testTree)+1)
+	}
+}
+
+func TestIndexRefresh(t *testing.T) {
+	tree := append([]SearchResult{}, testTree...)
+	m := newTestIndexClient(t, &tree)
+	idx, err := m.BuildIndex(context.Background(), FindOptions{Path: "archive@p:/data"})
+	if err != nil {
+		t.Fatalf("BuildIndex: %s", err)
+	}
+	defer idx.Close()
+	r := testInstance("archive@p:/data/a/x.h5", 0, 12, "2026-03-01T00:00:00")
+	tree = append(tree, r)
+	added, err := m.RefreshIndex(context.Background(), idx, FindOptions{})
+	if err != nil || added != 1 || idx.Count != len(testTree)+1 {
+		t.Errorf("first refresh: got %d new instances, %d in total, error %v, want 1, %d", added, idx.Count,
+			err, len(testTree)+1)
+	}
+	// already indexed instances are not added again
+	added, err = m.RefreshIndex(context.Background(), idx, FindOptions{})
+	if err != nil || added != 0 || idx.Count != len(testTree)+1 {
+		t.Errorf("second refresh: got %d new instances, %d in total, error %v, want 0, %d", added, idx.Count,
+			err, len(testTree)+1)
+	}
+	got := testIndexSearch(t, m, "archive@p:/data/a", FindOptions{Path: "archive@p:/data/a", MaxDepth: -1,
+		Versions: VersionsLatest, Pattern: "x.h5"})
+	if len(got) != 1 {
+		t.Errorf("latest versions: got %v, want one instance", got)
+	}
+}
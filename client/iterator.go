@@ -0,0 +1,241 @@
+/*
+Copyright © 2022 Antonin Portelli <antonin.portelli@me.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package client
+
+import "context"
+
+// Page iterator //////////////////////////////////////////////////////////////
+// Pages of search results without instance selection. Typical use:
+//
+//	it := m.FindPages(ctx, opt)
+//	defer it.Close()
+//	for it.Next() {
+//		... it.Page() ...
+//	}
+//	err := it.Err()
+type PageIterator struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	pages  <-chan page
+	cur    page
+	err    error
+}
+
+// Find pages of results, starting from opt.Cursor if set. The search stops
+// when ctx is done or the iterator is closed.
+func (m *MiriaClient) FindPages(ctx context.Context, opt FindOptions) *PageIterator {
+	ctx, cancel := context.WithCancel(ctx)
+	it := &PageIterator{ctx: ctx, cancel: cancel}
+	it.pages, it.err = m.pages(ctx, opt)
+	if it.err != nil {
+		cancel()
+	}
+	return it
+}
+
+// Advance to the next page, false after the last page or on error
+func (it *PageIterator) Next() bool {
+	if it.err != nil || it.pages == nil {
+		return false
+	}
+	p, ok := <-it.pages
+	if !ok {
+		// the pages channel is also closed early if the context is done
+		it.err = it.ctx.Err()
+		it.pages = nil
+		return false
+	}
+	if p.err != nil {
+		it.err = p.err
+		it.cancel()
+		return false
+	}
+	it.cur = p
+	return true
+}
+
+// Results of the current page
+func (it *PageIterator) Page() []SearchResult {
+	return it.cur.results
+}
+
+// Cursor to resume the search after the current page, empty for the last page
+// or if the search is split
+func (it *PageIterator) Cursor() string {
+	return it.cur.next
+}
+
+// First error encountered, nil if the search completed
+func (it *PageIterator) Err() error {
+	return it.err
+}
+
+// Stop the search and release its resources, can be called several times
+func (it *PageIterator) Close() error {
+	it.cancel()
+	if it.pages != nil {
+		// wait for the fetching goroutines to stop
+		for range it.pages {
+		}
+		it.pages = nil
+	}
+	return nil
+}
+
+// Result iterator ////////////////////////////////////////////////////////////
+// Search results after instance selection. Typical use:
+//
+//	it := m.Find(ctx, opt)
+//	defer it.Close()
+//	for it.Next() {
+//		... it.Result() ...
+//	}
+//	err := it.Err()
+//
+// Results can also be iterated by page with NextPage and Page, but both ways
+// cannot be mixed. If only some instances are kept, results are only available
+// once all pages have been fetched. The search stops once opt.Limit results are
+// returned.
+type ResultIterator struct {
+	pages    *PageIterator
+	selector *VersionSelector
+	selected []SearchResult // instances selected on the current page
+	page     []SearchResult
+	results  []SearchResult // results of the page not returned by Next yet
+	cur      SearchResult
+	err      error
+	done     bool
+	limit    int
+	count    int
+	scanned  int
+}
+
+// Find results, the search stops when ctx is done or the iterator is closed
+func (m *MiriaClient) Find(ctx context.Context, opt FindOptions) *ResultIterator {
+	it := &ResultIterator{limit: opt.Limit}
+	it.selector, it.err = opt.VersionSelector()
+	if it.err != nil {
+		return it
+	}
+	if it.selector != nil {
+		for _, r := range opt.Selected {
+			it.selector.Add(r)
+		}
+	}
+	it.pages = m.FindPages(ctx, opt)
+	return it
+}
+
+// Advance to the next page of results, false after the last page or on error.
+// If only some instances are kept, pages are empty until the last one, which
+// contains all the selected instances.
+func (it *ResultIterator) NextPage() bool {
+	if it.err != nil || it.done {
+		return false
+	}
+	if it.limit > 0 && it.count >= it.limit {
+		// no need to fetch further pages
+		it.done = true
+		it.pages.Close()
+		return false
+	}
+	if !it.pages.Next() {
+		it.done = true
+		it.err = it.pages.Err()
+		if it.err != nil || it.selector == nil {
+			return false
+		}
+		// selected instances are only known after the last page
+		it.selected = it.selected[:0]
+		it.page = it.selector.Results()
+	} else if it.selector != nil {
+		it.selected = it.selected[:0]
+		for _, r := range it.pages.Page() {
+			if it.selector.Add(r) {
+				it.selected = append(it.selected, r)
+			}
+		}
+		it.scanned += len(it.pages.Page())
+		it.page = nil
+	} else {
+		it.page = it.pages.Page()
+		it.scanned += len(it.page)
+	}
+	if it.limit > 0 && len(it.page) > it.limit-it.count {
+		it.page = it.page[:it.limit-it.count]
+	}
+	it.count += len(it.page)
+	return true
+}
+
+// Results of the current page
+func (it *ResultIterator) Page() []SearchResult {
+	return it.page
+}
+
+// Advance to the next result, false after the last result or on error
+func (it *ResultIterator) Next() bool {
+	for len(it.results) == 0 {
+		if !it.NextPage() {
+			return false
+		}
+		it.results = it.page
+	}
+	it.cur, it.results = it.results[0], it.results[1:]
+	return true
+}
+
+// Current result
+func (it *ResultIterator) Result() SearchResult {
+	return it.cur
+}
+
+// Cursor to resume the search after the current page, together with the
+// instances returned by Selected for all the pages so far, empty for the last
+// page or if the search is split
+func (it *ResultIterator) Cursor() string {
+	if it.done || it.pages == nil {
+		return ""
+	}
+	return it.pages.Cursor()
+}
+
+// Instances selected on the current page, possibly replacing instances of
+// the same objects selected on previous pages, nil if all instances are kept.
+// The slice is only valid until the next call to NextPage.
+func (it *ResultIterator) Selected() []SearchResult {
+	return it.selected
+}
+
+// Number of matching instances fetched so far, before instance selection
+func (it *ResultIterator) Scanned() int {
+	return it.scanned
+}
+
+// First error encountered, nil if the search completed
+func (it *ResultIterator) Err() error {
+	return it.err
+}
+
+// Stop the search and release its resources, can be called several times
+func (it *ResultIterator) Close() error {
+	if it.pages != nil {
+		return it.pages.Close()
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+/*
+Copyright © 2022 Antonin Portelli <antonin.portelli@me.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// Paths of all the results of the iterator
+func testResults(t *testing.T, it *ResultIterator) []string {
+	var paths []string
+
+	defer it.Close()
+	for it.Next() {
+		paths = append(paths, it.Result().ObjectPath)
+	}
+	if err := it.Err(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	return paths
+}
+
+func TestResultIterator(t *testing.T) {
+	m, _ := newTestClient(t, testListing(testTree, 2))
+	opt := FindOptions{Path: "archive@p:/data", MaxDepth: -1, PathPattern: "*.h5"}
+	got := testResults(t, m.Find(context.Background(), opt))
+	want := []string{"archive@p:/data/a/x.h5", "archive@p:/data/a/y.h5", "archive@p:/data/b/z.h5",
+		"archive@p:/data/c.h5"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestResultIteratorLimit(t *testing.T) {
+	m, _ := newTestClient(t, testListing(testTree, 2))
+	for _, versions := range []string{VersionsAll, VersionsLatest} {
+		opt := FindOptions{Path: "archive@p:/data", MaxDepth: -1, Versions: versions, Limit: 3}
+		got := testResults(t, m.Find(context.Background(), opt))
+		want := []string{"archive@p:/data", "archive@p:/data/a", "archive@p:/data/a/x.h5"}
+		if strings.Join(got, " ") != strings.Join(want, " ") {
+			t.Errorf("%s: got %v, want %v", versions, got, want)
+		}
+	}
+}
+
+func TestResultIteratorCancel(t *testing.T) {
+	m, _ := newTestClient(t, testListing(testTree, 1))
+	ctx, cancel := context.WithCancel(context.Background())
+	it := m.Find(ctx, FindOptions{Path: "archive@p:/data", MaxDepth: -1})
+	defer it.Close()
+	if !it.Next() {
+		t.Fatalf("no result: %v", it.Err())
+	}
+	cancel()
+	n := 1
+	for it.Next() {
+		n++
+	}
+	if !errors.Is(it.Err(), context.Canceled) || n == len(testTree) {
+		t.Errorf("got %d results and error %v, want fewer than %d and %v", n, it.Err(), len(testTree),
+			context.Canceled)
+	}
+}
+
+func TestResultIteratorClose(t *testing.T) {
+	m, _ := newTestClient(t, testListing(testTree, 1))
+	it := m.Find(context.Background(), FindOptions{Path: "archive@p:/data", MaxDepth: -1})
+	if !it.Next() {
+		t.Fatalf("no result: %v", it.Err())
+	}
+	it.Close()
+	it.Close()
+	for it.Next() {
+	}
+	if it.Err() != nil && !errors.Is(it.Err(), context.Canceled) {
+		t.Errorf("unexpected error after Close: %s", it.Err())
+	}
+}
+
+func TestResultIteratorErrors(t *testing.T) {
+	tests := []struct {
+		resp  any
+		check func(error) bool
+	}{
+		{map[string]any{"results": "none"}, func(err error) bool {
+			var e *DecodeError
+			return errors.As(err, &e)
+		}},
+		{map[string]any{"error": "invalid criteria"}, func(err error) bool {
+			var e *ServerError
+			return errors.As(err, &e)
+		}},
+	}
+	for _, tt := range tests {
+		m, _ := newTestClient(t, func(body string, cursor string) (int, any) {
+			return http.StatusOK, tt.resp
+		})
+		it := m.Find(context.Background(), FindOptions{Path: "archive@p:/data", MaxDepth: -1})
+		for it.Next() {
+		}
+		it.Close()
+		if !tt.check(it.Err()) {
+			t.Errorf("response %v: got error %v (%T)", tt.resp, it.Err(), it.Err())
+		}
+	}
+}
+
+func TestResultIteratorResume(t *testing.T) {
+	tree := append([]SearchResult{}, testTree...)
+	tree = append(tree, testResult("archive@p:/data/a/x.h5", false, 16))
+	tree[2].ObjectId, tree[len(tree)-1].ObjectId = 1, 1
+	tree[2].InstanceBackupDate, tree[len(tree)-1].InstanceBackupDate = "2026-01-01", "2026-02-01"
+	m, _ := newTestClient(t, testListing(tree, 3))
+	opt := FindOptions{Path: "archive@p:/data", MaxDepth: -1, PathPattern: "*.h5",
+		Versions: VersionsLatest}
+
+	// stop after the first page
+	it := m.Find(context.Background(), opt)
+	if !it.NextPage() || len(it.Page()) != 0 || it.Cursor() == "" {
+		t.Fatalf("first page: got %v, cursor %q, error %v", it.Page(), it.Cursor(), it.Err())
+	}
+	opt.Cursor, opt.Selected = it.Cursor(), it.Selected()
+	scanned := it.Scanned()
+	it.Close()
+
+	it = m.Find(context.Background(), opt)
+	var sizes []uint64
+	for it.Next() {
+		sizes = append(sizes, it.Result().ObjectSize)
+	}
+	scanned += it.Scanned()
+	it.Close()
+	if it.Err() != nil || len(sizes) != 4 || sizes[0] != 16 || scanned != 5 {
+		t.Errorf("got sizes %v from %d instances, error %v, want [16 2 4 8] from 5", sizes, scanned,
+			it.Err())
+	}
+}
@@ -0,0 +1,289 @@
+/*
+Copyright © 2022 Antonin Portelli <antonin.portelli@me.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+
+	log "github.com/aportelli/golog"
+	"github.com/mitchellh/mapstructure"
+)
+
+// Page of filtered search results, next is the cursor of the following page
+// (empty for the last page)
+type page struct {
+	results []SearchResult
+	next    string
+	err     error
+}
+
+// Search of a subtree, results are filtered client-side with expr unless the
+// criteria sent to the server are exact
+type scan struct {
+	req   FindInstanceRequest
+	expr  Expr
+	exact bool
+	depth bool // the criteria contain depth rules
+	// fail with errNoDepthRules if the server does not support the depth
+	// rules, instead of checking them client-side
+	strict bool
+}
+
+// Returned by strict scans if the server rejects or ignores depth rules
+var errNoDepthRules = errors.New("depth criteria not supported by the server")
+
+// Criteria matching everything
+func matchAll() FindCriteria {
+	return FindCriteria{Condition: "AND", Rules: []any{
+		FindRule{Type: "FILE_NAME", Value: "", Value2: nil, Operator: "contains"},
+	}}
+}
+
+func newScan(root string, expr Expr, pageSize int) scan {
+	var s scan
+
+	s.req.RootObjectPath = root
+	s.req.ResultType = "INST"
+	s.req.PageSize = pageSize
+	s.expr = expr
+	crit, exact := expr.pushdown()
+	s.exact = exact
+	switch c := crit.(type) {
+	case FindCriteria:
+		s.req.Criteria = c
+	case FindRule:
+		s.req.Criteria = FindCriteria{Condition: "AND", Rules: []any{c}}
+	default:
+		s.req.Criteria = matchAll()
+	}
+	_, s.depth = withoutDepthRules(s.req.Criteria)
+	return s
+}
+
+// Same scan without the depth rules, which are still checked client-side
+func (s scan) withoutDepth() scan {
+	s.req.Criteria, _ = withoutDepthRules(s.req.Criteria)
+	if len(s.req.Criteria.Rules) == 0 {
+		s.req.Criteria = matchAll()
+	}
+	s.exact = false
+	s.depth = false
+	return s
+}
+
+func (s scan) filter(results []SearchResult) []SearchResult {
+	if s.exact {
+		return results
+	}
+	filtered := make([]SearchResult, 0, len(results))
+	for _, r := range results {
+		if s.expr.Match(r) {
+			filtered = append(filtered, r)
+		}
+	}
+	return filtered
+}
+
+// Request one page of results, starting from the first one if cursor is
+// empty, decode the response into out and return the cursor of the next page
+func (m *MiriaClient) searchPage(ctx context.Context, req FindInstanceRequest, cursor string,
+	out any) (string, error) {
+	path := "/files/advanced-search/"
+	if cursor != "" {
+		path += "?page=" + url.QueryEscape(cursor)
+	}
+	resp, err := m.PostContext(ctx, path, req, true)
+	if err != nil {
+		return "", err
+	}
+	err = mapstructure.Decode(resp, out)
+	if err != nil {
+		return "", &DecodeError{Err: err}
+	}
+	next, _ := resp["nextPage"].(string)
+	return next, nil
+}
+
+// Fetch one page, starting from the first one if cursor is empty. An empty
+// first page does not show that the server supports the depth rules, it could
+// also match nothing with a rule type it does not know. Until results
+// satisfying depth rules are seen, the page is then requested again without
+// them, and if this finds results, the scan continues without depth rules.
+func (m *MiriaClient) fetchPage(ctx context.Context, s *scan, cursor string) page {
+	var searchResp SearchResponse
+
+	next, err := m.searchPage(ctx, s.req, cursor, &searchResp)
+	if err != nil {
+		return page{err: err}
+	}
+	results := searchResp.Results
+	if !s.depth || m.noDepthRules.Load() {
+		return page{results: s.filter(results), next: next}
+	}
+	switch {
+	case len(results) > 0 && !depthHonoured(s.req.Criteria, results):
+		// the results are filtered anyway, but the following requests do not
+		// need the depth rules
+		log.Dbg.Println("depth criteria ignored by the server, depth is only checked client-side")
+		m.noDepthRules.Store(true)
+		if s.strict {
+			return page{err: errNoDepthRules}
+		}
+	case len(results) > 0:
+		m.depthRulesSeen.Store(true)
+	case cursor == "" && !m.depthRulesSeen.Load():
+		var plainResp SearchResponse
+
+		plain := s.withoutDepth()
+		plainNext, err := m.searchPage(ctx, plain.req, "", &plainResp)
+		if err != nil {
+			return page{err: err}
+		}
+		if len(plainResp.Results) == 0 {
+			break
+		}
+		for _, r := range plainResp.Results {
+			if depthHonoured(s.req.Criteria, []SearchResult{r}) {
+				log.Dbg.Println("depth criteria match nothing on the server, depth is only checked client-side")
+				m.noDepthRules.Store(true)
+				break
+			}
+		}
+		if s.strict {
+			return page{err: errNoDepthRules}
+		}
+		*s = plain
+		results, next = plainResp.Results, plainNext
+	}
+	return page{results: s.filter(results), next: next}
+}
+
+// Whether err can be the server rejecting the criteria of a request, as
+// opposed to authentication or missing path errors
+func criteriaRejected(err error) bool {
+	var httpErr *HTTPError
+	var serverErr *ServerError
+	if errors.As(err, &httpErr) {
+		return httpErr.StatusCode == http.StatusBadRequest ||
+			httpErr.StatusCode == http.StatusUnprocessableEntity ||
+			httpErr.StatusCode >= http.StatusInternalServerError
+	}
+	return errors.As(err, &serverErr)
+}
+
+// Send page unless the context is done
+func sendPage(ctx context.Context, pages chan<- page, p page) bool {
+	select {
+	case pages <- p:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// Fetch all pages in a goroutine, the next page is requested while the
+// previous ones are consumed, with at most depth pages waiting in the channel.
+// The channel is closed after the last page, an error, or if ctx is done.
+// If the server rejects the depth rules of the criteria of the first page, or
+// returns an error that could be a rejection, the request is sent again
+// without them, as well as all the following ones from this client. The same
+// happens if the server ignores the depth rules, but the current scan
+// continues with them. The cursors of later pages belong to the criteria they
+// were requested with, so their errors are returned as they are.
+func (m *MiriaClient) fetchPages(ctx context.Context, s scan, cursor string, depth int) <-chan page {
+	pages := make(chan page, depth)
+	go func() {
+		defer close(pages)
+		if s.depth && cursor == "" && m.noDepthRules.Load() {
+			if s.strict {
+				sendPage(ctx, pages, page{err: errNoDepthRules})
+				return
+			}
+			s = s.withoutDepth()
+		}
+		for {
+			p := m.fetchPage(ctx, &s, cursor)
+			if s.depth && cursor == "" && criteriaRejected(p.err) {
+				log.Dbg.Printf("depth criteria rejected by the server (%s), depth is only checked client-side",
+					p.err.Error())
+				m.noDepthRules.Store(true)
+				if s.strict {
+					sendPage(ctx, pages, page{err: errNoDepthRules})
+					return
+				}
+				s = s.withoutDepth()
+				continue
+			}
+			if !sendPage(ctx, pages, p) || p.err != nil || p.next == "" {
+				return
+			}
+			cursor = p.next
+		}
+	}()
+	return pages
+}
+
+// Fetch the scans concurrently and merge their pages in order. At most
+// width scans are running or waiting to be consumed at any time, since they
+// are started in order the first unfinished scan is always running.
+func (m *MiriaClient) fetchScans(ctx context.Context, scans []scan, depth int, width int) <-chan page {
+	pages := make(chan page, depth)
+	streams := make(chan (<-chan page), width)
+	go func() {
+		defer close(streams)
+		slots := make(chan struct{}, width)
+		for _, s := range scans {
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			in := m.fetchPages(ctx, s, "", depth)
+			out := make(chan page, depth)
+			go func() {
+				defer func() { <-slots }()
+				defer close(out)
+				for p := range in {
+					// cursors of a subtree cannot be used to resume the full search
+					p.next = ""
+					if !sendPage(ctx, out, p) {
+						return
+					}
+				}
+			}()
+			select {
+			case streams <- out:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	go func() {
+		defer close(pages)
+		for stream := range streams {
+			for p := range stream {
+				if !sendPage(ctx, pages, p) {
+					return
+				}
+			}
+		}
+	}()
+	return pages
+}
@@ -0,0 +1,373 @@
+/*
+Copyright © 2022 Antonin Portelli <antonin.portelli@me.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Mock advanced-search handler, body is the JSON request and cursor the
+// requested page, empty for the first one
+type testHandler func(body string, cursor string) (status int, resp any)
+
+// Client of a mock server, the returned counter is the number of requests
+func newTestClient(t *testing.T, h testHandler) (*MiriaClient, *int32) {
+	var count int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&count, 1)
+		body, _ := io.ReadAll(r.Body)
+		status, resp := h(string(body), r.URL.Query().Get("page"))
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(resp)
+	}))
+	t.Cleanup(server.Close)
+	m := NewMiria(strings.TrimPrefix(server.URL, "http://"))
+	m.auth.Access = "test"
+	m.authChecked = true
+	return m, &count
+}
+
+// Handler listing the results under the requested root, n per page. Search
+// criteria are ignored.
+func testListing(results []SearchResult, n int) testHandler {
+	return func(body string, cursor string) (int, any) {
+		var req FindInstanceRequest
+		var under []SearchResult
+
+		json.Unmarshal([]byte(body), &req)
+		for _, r := range results {
+			if UnderPath(r.ObjectPath, req.RootObjectPath) {
+				under = append(under, r)
+			}
+		}
+		start, _ := strconv.Atoi(cursor)
+		end := start + n
+		next := ""
+		if end < len(under) {
+			next = strconv.Itoa(end)
+		} else {
+			end = len(under)
+		}
+		return http.StatusOK, map[string]any{"results": under[start:end], "nextPage": next}
+	}
+}
+
+// Whether r satisfies the depth rules of decoded criteria
+func testDepthMatch(crit map[string]any, r SearchResult) bool {
+	rules, _ := crit["rules"].([]any)
+	for _, rule := range rules {
+		rule, _ := rule.(map[string]any)
+		if _, ok := rule["rules"]; ok {
+			if !testDepthMatch(rule, r) {
+				return false
+			}
+			continue
+		}
+		bound, _ := rule["value"].(float64)
+		d := float64(PathDepth(r.ObjectPath))
+		if rule["type"] == depthRule && (rule["operator"] == "greater or equal" && d < bound ||
+			rule["operator"] == "less or equal" && d > bound) {
+			return false
+		}
+	}
+	return true
+}
+
+// Same as testListing, but only the results satisfying the depth rules are
+// listed
+func testDepthListing(results []SearchResult, n int) testHandler {
+	return func(body string, cursor string) (int, any) {
+		var req struct{ Criteria map[string]any }
+
+		json.Unmarshal([]byte(body), &req)
+		var matched []SearchResult
+		for _, r := range results {
+			if testDepthMatch(req.Criteria, r) {
+				matched = append(matched, r)
+			}
+		}
+		return testListing(matched, n)(body, cursor)
+	}
+}
+
+// Paths of all the results of the pages
+func testPaths(t *testing.T, pages <-chan page) []string {
+	var paths []string
+
+	for p := range pages {
+		if p.err != nil {
+			t.Fatalf("unexpected error: %s", p.err)
+		}
+		for _, r := range p.results {
+			paths = append(paths, r.ObjectPath)
+		}
+	}
+	return paths
+}
+
+var testTree = []SearchResult{
+	testResult("archive@p:/data", true, 0),
+	testResult("archive@p:/data/a", true, 0),
+	testResult("archive@p:/data/a/x.h5", false, 1),
+	testResult("archive@p:/data/a/y.h5", false, 2),
+	testResult("archive@p:/data/b", true, 0),
+	testResult("archive@p:/data/b/z.h5", false, 4),
+	testResult("archive@p:/data/c.h5", false, 8),
+}
+
+func TestDepthRulesRejected(t *testing.T) {
+	for _, status := range []int{http.StatusOK, http.StatusBadRequest, http.StatusInternalServerError} {
+		list := testListing(testTree, 2)
+		m, count := newTestClient(t, func(body string, cursor string) (int, any) {
+			if strings.Contains(body, depthRule) {
+				return status, map[string]any{"error": "unknown rule type"}
+			}
+			return list(body, cursor)
+		})
+		s := newScan("archive@p:/data", depthExpr{root: 1, min: 1, max: 1}, 2)
+		got := testPaths(t, m.fetchPages(context.Background(), s, "", 1))
+		want := []string{"archive@p:/data/a", "archive@p:/data/b", "archive@p:/data/c.h5"}
+		if strings.Join(got, " ") != strings.Join(want, " ") {
+			t.Errorf("status %d: got %v, want %v", status, got, want)
+		}
+		// one rejected request, then 4 pages
+		if *count != 5 || !m.noDepthRules.Load() {
+			t.Errorf("status %d: got %d requests, depth rules disabled %v, want 5, true", status, *count,
+				m.noDepthRules.Load())
+		}
+	}
+}
+
+func TestDepthRulesIgnored(t *testing.T) {
+	m, count := newTestClient(t, testListing(testTree, 3))
+	s := newScan("archive@p:/data", depthExpr{root: 1, min: 0, max: 1}, 3)
+	got := testPaths(t, m.fetchPages(context.Background(), s, "", 1))
+	want := []string{"archive@p:/data", "archive@p:/data/a", "archive@p:/data/b", "archive@p:/data/c.h5"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	// the pages are not requested again
+	if *count != 3 || !m.noDepthRules.Load() {
+		t.Errorf("got %d requests, depth rules disabled %v, want 3, true", *count, m.noDepthRules.Load())
+	}
+}
+
+func TestDepthRulesLaterError(t *testing.T) {
+	list := testDepthListing(testTree, 1)
+	m, _ := newTestClient(t, func(body string, cursor string) (int, any) {
+		// the second page fails, its cursor belongs to the criteria with depth rules
+		if cursor == "1" {
+			return http.StatusInternalServerError, map[string]any{"detail": "server error"}
+		}
+		return list(body, cursor)
+	})
+	s := newScan("archive@p:/data", depthExpr{root: 1, min: 1, max: 1}, 1)
+	var got []string
+	var err error
+	for p := range m.fetchPages(context.Background(), s, "", 1) {
+		for _, r := range p.results {
+			got = append(got, r.ObjectPath)
+		}
+		err = p.err
+	}
+	if strings.Join(got, " ") != "archive@p:/data/a" || err == nil || m.noDepthRules.Load() {
+		t.Errorf("got %v, error %v, depth rules disabled %v, want [archive@p:/data/a], an error, false", got,
+			err, m.noDepthRules.Load())
+	}
+}
+
+func TestDepthRulesMatchNothing(t *testing.T) {
+	list := testListing(testTree, 2)
+	m, count := newTestClient(t, func(body string, cursor string) (int, any) {
+		if strings.Contains(body, depthRule) {
+			return http.StatusOK, map[string]any{"results": []SearchResult{}, "nextPage": ""}
+		}
+		return list(body, cursor)
+	})
+	s := newScan("archive@p:/data", depthExpr{root: 1, min: 1, max: 1}, 2)
+	got := testPaths(t, m.fetchPages(context.Background(), s, "", 1))
+	want := []string{"archive@p:/data/a", "archive@p:/data/b", "archive@p:/data/c.h5"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	// the empty page, then 4 pages without depth rules
+	if *count != 5 || !m.noDepthRules.Load() {
+		t.Errorf("got %d requests, depth rules disabled %v, want 5, true", *count, m.noDepthRules.Load())
+	}
+}
+
+func TestDepthRulesEmpty(t *testing.T) {
+	m, count := newTestClient(t, testDepthListing(testTree, 10))
+	// nothing that deep, the first page is checked without depth rules
+	s := newScan("archive@p:/data", depthExpr{root: 1, min: 5, max: -1}, 10)
+	if got := testPaths(t, m.fetchPages(context.Background(), s, "", 1)); len(got) != 0 ||
+		*count != 2 || m.noDepthRules.Load() {
+		t.Errorf("got %v after %d requests, depth rules disabled %v, want none after 2, false", got, *count,
+			m.noDepthRules.Load())
+	}
+	// once the depth rules are seen to work, empty pages are trusted
+	s = newScan("archive@p:/data", depthExpr{root: 1, min: 1, max: 1}, 10)
+	testPaths(t, m.fetchPages(context.Background(), s, "", 1))
+	s = newScan("archive@p:/data", depthExpr{root: 1, min: 5, max: -1}, 10)
+	if got := testPaths(t, m.fetchPages(context.Background(), s, "", 1)); len(got) != 0 || *count != 4 {
+		t.Errorf("got %v after %d requests, want none after 4", got, *count)
+	}
+}
+
+func TestAuthErrorKeepsDepthRules(t *testing.T) {
+	m, count := newTestClient(t, func(body string, cursor string) (int, any) {
+		return http.StatusForbidden, map[string]any{"detail": "forbidden"}
+	})
+	s := newScan("archive@p:/data", depthExpr{root: 1, min: 0, max: 1}, 3)
+	p := <-m.fetchPages(context.Background(), s, "", 1)
+	if p.err == nil || *count != 1 || m.noDepthRules.Load() {
+		t.Errorf("got error %v after %d requests, depth rules disabled %v, want error, 1, false", p.err,
+			*count, m.noDepthRules.Load())
+	}
+}
+
+// Scans of the whole tree, one result per page
+func testScans(roots ...string) []scan {
+	var scans []scan
+	for _, root := range roots {
+		scans = append(scans, newScan(root, andExpr{}, 1))
+	}
+	return scans
+}
+
+func TestFetchScansOrder(t *testing.T) {
+	list := testListing(testTree, 1)
+	m, _ := newTestClient(t, func(body string, cursor string) (int, any) {
+		// the first scan finishes last
+		if strings.Contains(body, `"archive@p:/data/a"`) {
+			time.Sleep(20 * time.Millisecond)
+		}
+		return list(body, cursor)
+	})
+	scans := testScans("archive@p:/data/a", "archive@p:/data/b", "archive@p:/data/c.h5")
+	got := testPaths(t, m.fetchScans(context.Background(), scans, 1, 3))
+	want := []string{"archive@p:/data/a", "archive@p:/data/a/x.h5", "archive@p:/data/a/y.h5",
+		"archive@p:/data/b", "archive@p:/data/b/z.h5", "archive@p:/data/c.h5"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestFetchScansBounded(t *testing.T) {
+	var mutex sync.Mutex
+	roots := make(map[string]bool)
+	list := testListing(testTree, 1)
+	m, _ := newTestClient(t, func(body string, cursor string) (int, any) {
+		var req FindInstanceRequest
+
+		json.Unmarshal([]byte(body), &req)
+		mutex.Lock()
+		roots[req.RootObjectPath] = true
+		mutex.Unlock()
+		return list(body, cursor)
+	})
+	scans := testScans("archive@p:/data", "archive@p:/data/a", "archive@p:/data/b", "archive@p:/data/c.h5")
+	pages := m.fetchScans(context.Background(), scans, 1, 2)
+	// the pages are not consumed, and the first two scans have more pages than
+	// the buffers can hold, so the others cannot start
+	time.Sleep(50 * time.Millisecond)
+	mutex.Lock()
+	if len(roots) != 2 || !roots["archive@p:/data"] || !roots["archive@p:/data/a"] {
+		t.Errorf("got scans of %v before consuming, want the first two", roots)
+	}
+	mutex.Unlock()
+	if got := testPaths(t, pages); len(got) != 7+3+2+1 {
+		t.Errorf("got %d results, want %d", len(got), 7+3+2+1)
+	}
+	if len(roots) != 4 {
+		t.Errorf("got scans of %v, want all of them", roots)
+	}
+}
+
+func TestFetchScansCancel(t *testing.T) {
+	m, count := newTestClient(t, testListing(testTree, 1))
+	ctx, cancel := context.WithCancel(context.Background())
+	scans := testScans("archive@p:/data", "archive@p:/data/a", "archive@p:/data/b")
+	pages := m.fetchScans(ctx, scans, 1, 2)
+	<-pages
+	cancel()
+	done := make(chan struct{})
+	go func() {
+		for range pages {
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("pages not closed after cancellation")
+	}
+	// requests sent before the cancellation can still arrive, but the scans
+	// stop afterwards
+	time.Sleep(50 * time.Millisecond)
+	n := atomic.LoadInt32(count)
+	time.Sleep(50 * time.Millisecond)
+	if got := atomic.LoadInt32(count); got != n || n >= 7+3+2 {
+		t.Errorf("got %d then %d requests, want fewer than %d and no more after cancellation", n, got,
+			7+3+2)
+	}
+}
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		name     string
+		handler  testHandler
+		requests int32
+	}{
+		// one request for the subdirectories and each of the 3 scans
+		{"honoured", testDepthListing(testTree, 10), 4},
+		// one request to find that depth rules are not supported, then the full scan
+		{"ignored", testListing(testTree, 10), 2},
+		{"rejected", func(body string, cursor string) (int, any) {
+			if strings.Contains(body, depthRule) {
+				return http.StatusBadRequest, map[string]any{"detail": "unknown rule type"}
+			}
+			return testListing(testTree, 10)(body, cursor)
+		}, 2},
+	}
+	for _, tt := range tests {
+		m, count := newTestClient(t, tt.handler)
+		pages, err := m.pages(context.Background(), FindOptions{Path: "archive@p:/data", MaxDepth: -1,
+			Split: true})
+		if err != nil {
+			t.Fatalf("%s: %s", tt.name, err)
+		}
+		if got := testPaths(t, pages); len(got) != len(testTree) {
+			t.Errorf("%s: got %v, want all %d results", tt.name, got, len(testTree))
+		}
+		if *count != tt.requests {
+			t.Errorf("%s: got %d requests, want %d", tt.name, *count, tt.requests)
+		}
+	}
+}
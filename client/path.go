@@ -0,0 +1,60 @@
+/*
+Copyright © 2022 Antonin Portelli <antonin.portelli@me.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package client
+
+import (
+	"path"
+	"strings"
+)
+
+// Split object path into archive prefix (e.g. archive@project:) and path
+func SplitObjectPath(p string) (prefix string, rest string) {
+	if i := strings.Index(p, ":"); i >= 0 {
+		return p[:i+1], p[i+1:]
+	}
+	return "", p
+}
+
+// Parent directory of an object path, keeping the archive prefix
+func ParentPath(p string) string {
+	prefix, rest := SplitObjectPath(p)
+	return prefix + path.Dir(rest)
+}
+
+// Object path without trailing or duplicate slashes
+func CleanObjectPath(p string) string {
+	prefix, rest := SplitObjectPath(p)
+	return prefix + path.Clean("/"+rest)
+}
+
+// Whether p is root or one of its descendants
+func UnderPath(p string, root string) bool {
+	return p == root || strings.HasPrefix(p, strings.TrimSuffix(root, "/")+"/")
+}
+
+// Number of components in the path, e.g. 2 for archive@project:/a/b
+func PathDepth(path string) int {
+	var depth int = 0
+	_, path = SplitObjectPath(path)
+	for _, name := range strings.Split(path, "/") {
+		if name != "" {
+			depth++
+		}
+	}
+	return depth
+}
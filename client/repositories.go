@@ -0,0 +1,129 @@
+/*
+Copyright © 2022 Antonin Portelli <antonin.portelli@me.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package client
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/url"
+	"os"
+	"path"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+// Repository names are cached for this duration
+const RepositoryCacheDuration = 24 * time.Hour
+
+type repositoryCache struct {
+	Fetched time.Time      `json:"fetched"`
+	Names   map[int]string `json:"names"`
+}
+
+type repositoryResponse struct {
+	NextPage string     `json:"nextPage"`
+	Results  []ObjectId `json:"results"`
+}
+
+// Cache file of the configured host
+func (m *MiriaClient) repositoryCacheFile() (string, error) {
+	cacheDir, err := AppCacheDir()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(m.host))
+	return cacheDir + "/repositories-" + hex.EncodeToString(sum[:8]) + ".json", nil
+}
+
+// Repository names by ID from the cache, whatever its age, without contacting
+// the server
+func (m *MiriaClient) CachedRepositoryNames() (map[int]string, error) {
+	var cache repositoryCache
+
+	file, err := m.repositoryCacheFile()
+	if err != nil {
+		return nil, err
+	}
+	buf, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(buf, &cache)
+	if err != nil {
+		return nil, err
+	}
+	return cache.Names, nil
+}
+
+// Repository names by ID, from the cache unless it is outdated or refresh is
+// true
+func (m *MiriaClient) RepositoryNames(refresh bool) (map[int]string, error) {
+	var cache repositoryCache
+
+	file, err := m.repositoryCacheFile()
+	if err != nil {
+		return nil, err
+	}
+	if !refresh {
+		buf, err := os.ReadFile(file)
+		if err == nil && json.Unmarshal(buf, &cache) == nil &&
+			time.Since(cache.Fetched) < RepositoryCacheDuration {
+			return cache.Names, nil
+		}
+	}
+	cache = repositoryCache{Fetched: time.Now(), Names: make(map[int]string)}
+	next := ""
+	for {
+		var repoResp repositoryResponse
+
+		reqPath := "/repositories/"
+		if next != "" {
+			reqPath += "?page=" + url.QueryEscape(next)
+		}
+		resp, err := m.Get(reqPath, true)
+		if err != nil {
+			return nil, err
+		}
+		err = mapstructure.Decode(resp, &repoResp)
+		if err != nil {
+			return nil, &DecodeError{Err: err}
+		}
+		for _, r := range repoResp.Results {
+			cache.Names[r.Id] = r.Name
+		}
+		if repoResp.NextPage == "" {
+			break
+		}
+		next = repoResp.NextPage
+	}
+	buf, err := json.MarshalIndent(cache, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	err = os.MkdirAll(path.Dir(file), 0700)
+	if err != nil {
+		return nil, err
+	}
+	err = os.WriteFile(file, buf, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return cache.Names, nil
+}
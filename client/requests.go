@@ -25,13 +25,16 @@ type AuthRequest struct {
 }
 
 type FindInstanceRequest struct {
-	RootObjectPath string `json:"rootObjectPath"`
-	ResultType     string `json:"resultType"`
-	PageSize       int    `json:"pageSize"`
-	Criteria       struct {
-		Condition string     `json:"condition"`
-		Rules     []FindRule `json:"rules"`
-	} `json:"criteria"`
+	RootObjectPath string       `json:"rootObjectPath"`
+	ResultType     string       `json:"resultType"`
+	PageSize       int          `json:"pageSize"`
+	Criteria       FindCriteria `json:"criteria"`
+}
+
+// Group of rules, elements of Rules are either FindRule or FindCriteria
+type FindCriteria struct {
+	Condition string `json:"condition"`
+	Rules     []any  `json:"rules"`
 }
 
 type FindRule struct {
@@ -0,0 +1,80 @@
+/*
+Copyright © 2022 Antonin Portelli <antonin.portelli@me.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// Instance of an object with all the fields returned by the server
+type ObjectInstance struct {
+	SearchResult `mapstructure:",squash"`
+	Metadata     map[string]any `mapstructure:",remain"` // fields not in SearchResult
+}
+
+// All instances of the object at path p, oldest first. Only the entries of the
+// parent directory with the same name are searched.
+func (m *MiriaClient) Stat(ctx context.Context, p string) ([]ObjectInstance, error) {
+	var instances []ObjectInstance
+
+	p = CleanObjectPath(p)
+	parent := ParentPath(p)
+	if parent == p {
+		return nil, fmt.Errorf("'%s' is an archive root", p)
+	}
+	s := newScan(parent, exactPathExpr(p), m.pageSize)
+	cursor := ""
+	for {
+		var resp struct{ Results []ObjectInstance }
+
+		next, err := m.searchPage(ctx, s.req, cursor, &resp)
+		if err != nil {
+			return nil, err
+		}
+		for _, inst := range resp.Results {
+			if s.expr.Match(inst.SearchResult) {
+				instances = append(instances, inst)
+			}
+		}
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	sort.SliceStable(instances, func(i, j int) bool {
+		return instances[i].BackupTime().Before(instances[j].BackupTime())
+	})
+	return instances, nil
+}
+
+// Whether the object at path p has an instance, in the index if idx is not nil.
+// Archive roots always exist.
+func (m *MiriaClient) Exists(ctx context.Context, p string, idx *Index) (bool, error) {
+	p = CleanObjectPath(p)
+	parent := ParentPath(p)
+	if parent == p {
+		return true, nil
+	}
+	it := m.Find(ctx, FindOptions{Path: parent, MinDepth: 1, MaxDepth: 1, Expr: exactPathExpr(p), Limit: 1,
+		Index: idx})
+	defer it.Close()
+	found := it.Next()
+	return found, it.Err()
+}
@@ -0,0 +1,45 @@
+/*
+Copyright © 2022 Antonin Portelli <antonin.portelli@me.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package client
+
+import (
+	"context"
+	"testing"
+)
+
+func TestExists(t *testing.T) {
+	m, _ := newTestClient(t, testListing(testTree, 2))
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"archive@p:/", true},
+		{"archive@p:/data", true},
+		{"archive@p:/data/a/", true},
+		{"archive@p:/data/c.h5", true},
+		{"archive@p:/data/nope", false},
+		// same name in another directory
+		{"archive@p:/data/b/x.h5", false},
+	}
+	for _, tt := range tests {
+		got, err := m.Exists(context.Background(), tt.path, nil)
+		if err != nil || got != tt.want {
+			t.Errorf("%q: got %v, error %v, want %v", tt.path, got, err, tt.want)
+		}
+	}
+}
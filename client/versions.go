@@ -0,0 +1,88 @@
+/*
+Copyright © 2022 Antonin Portelli <antonin.portelli@me.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package client
+
+import "fmt"
+
+// Instance selection modes
+const (
+	VersionsAll    = "all"
+	VersionsLatest = "latest"
+	VersionsFirst  = "first"
+)
+
+// Keep one instance per object, in order of first appearance
+type VersionSelector struct {
+	latest bool
+	best   map[any]int
+	result []SearchResult
+}
+
+// New selector, nil if all instances are kept
+func NewVersionSelector(mode string) (*VersionSelector, error) {
+	switch mode {
+	case VersionsAll:
+		return nil, nil
+	case VersionsLatest, VersionsFirst:
+		return &VersionSelector{latest: mode == VersionsLatest, best: make(map[any]int),
+			result: make([]SearchResult, 0)}, nil
+	default:
+		return nil, fmt.Errorf("unknown version selection '%s' (possible values: %s, %s, %s)", mode,
+			VersionsAll, VersionsLatest, VersionsFirst)
+	}
+}
+
+// Key identifying the object of an instance, the path is used if the server
+// does not provide an ID
+func ObjectKey(r SearchResult) any {
+	if r.ObjectId != 0 {
+		return r.ObjectId
+	}
+	return r.ObjectPath
+}
+
+// Whether instance a is newer than b, using the instance ID to break ties
+func newer(a SearchResult, b SearchResult) bool {
+	ta, tb := a.BackupTime(), b.BackupTime()
+	if ta.Equal(tb) {
+		return a.InstanceId > b.InstanceId
+	}
+	return ta.After(tb)
+}
+
+// Add instance, replacing the selected instance of the same object if needed.
+// Returns whether the instance is selected.
+func (v *VersionSelector) Add(r SearchResult) bool {
+	key := ObjectKey(r)
+	i, ok := v.best[key]
+	if !ok {
+		v.best[key] = len(v.result)
+		v.result = append(v.result, r)
+		return true
+	}
+	if newer(r, v.result[i]) == v.latest {
+		v.result[i] = r
+		return true
+	}
+	return false
+}
+
+// Selected instances, adding them to a new selector restores its state, as
+// adding all the instances selected so far in order
+func (v *VersionSelector) Results() []SearchResult {
+	return v.result
+}
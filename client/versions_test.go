@@ -0,0 +1,97 @@
+/*
+Copyright © 2022 Antonin Portelli <antonin.portelli@me.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package client
+
+import (
+	"reflect"
+	"testing"
+)
+
+func testInstance(p string, objectId int, instanceId int, date string) SearchResult {
+	r := testResult(p, false, uint64(instanceId))
+	r.ObjectId = objectId
+	r.InstanceId = instanceId
+	r.InstanceBackupDate = date
+	return r
+}
+
+func TestVersionSelector(t *testing.T) {
+	instances := []SearchResult{
+		testInstance("archive@p:/a", 1, 11, "2026-02-01T00:00:00"),
+		testInstance("archive@p:/b", 2, 21, "2026-01-01T00:00:00"),
+		testInstance("archive@p:/a", 1, 12, "2026-03-01T00:00:00"),
+		testInstance("archive@p:/a", 1, 10, "2026-01-01T00:00:00"),
+		// same date, the instance ID breaks the tie
+		testInstance("archive@p:/b", 2, 23, "2026-01-01T00:00:00"),
+		testInstance("archive@p:/b", 2, 22, "2026-01-01T00:00:00"),
+		// no object ID, the path identifies the object
+		testInstance("archive@p:/c", 0, 31, "2026-01-01T00:00:00"),
+		testInstance("archive@p:/d", 0, 41, "2026-01-01T00:00:00"),
+		testInstance("archive@p:/c", 0, 32, "2026-05-01T00:00:00"),
+	}
+	tests := []struct {
+		mode string
+		want []int
+	}{
+		{VersionsLatest, []int{12, 23, 32, 41}},
+		{VersionsFirst, []int{10, 21, 31, 41}},
+	}
+	for _, tt := range tests {
+		v, err := NewVersionSelector(tt.mode)
+		if err != nil {
+			t.Fatalf("NewVersionSelector(%q): %s", tt.mode, err)
+		}
+		for _, r := range instances {
+			v.Add(r)
+		}
+		got := v.Results()
+		ok := len(got) == len(tt.want)
+		for i := 0; ok && i < len(got); i++ {
+			ok = got[i].InstanceId == tt.want[i]
+		}
+		if !ok {
+			ids := make([]int, len(got))
+			for i, r := range got {
+				ids[i] = r.InstanceId
+			}
+			t.Errorf("%s: got instances %v, want %v", tt.mode, ids, tt.want)
+		}
+		// restoring the selected instances gives the same selection
+		restored, _ := NewVersionSelector(tt.mode)
+		for _, r := range got {
+			restored.Add(r)
+		}
+		for _, r := range instances[len(instances)-3:] {
+			restored.Add(r)
+			v.Add(r)
+		}
+		if !reflect.DeepEqual(restored.Results(), v.Results()) {
+			t.Errorf("%s: restored selector differs, got %v, want %v", tt.mode, restored.Results(),
+				v.Results())
+		}
+	}
+}
+
+func TestVersionSelectorModes(t *testing.T) {
+	if v, err := NewVersionSelector(VersionsAll); v != nil || err != nil {
+		t.Errorf("NewVersionSelector(%q): got %v, %v, want nil, nil", VersionsAll, v, err)
+	}
+	if _, err := NewVersionSelector("newest"); err == nil {
+		t.Errorf("NewVersionSelector(%q): expected an error", "newest")
+	}
+}
@@ -0,0 +1,262 @@
+/*
+Copyright © 2022 Antonin Portelli <antonin.portelli@me.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	log "github.com/aportelli/golog"
+	"golang.org/x/term"
+)
+
+// Keys of the browser
+const (
+	keyNone = iota
+	keyUp
+	keyDown
+	keyPageUp
+	keyPageDown
+	keyOpen
+	keyParent
+	keySortSize
+	keySortCount
+	keySortName
+	keyQuit
+)
+
+const browserBarWidth = 10
+
+// Terminal browser of a size tree ////////////////////////////////////////////
+type browser struct {
+	tree   ncduTree
+	dir    *ncduNode
+	cursor int
+	offset int // first line shown
+	sortBy int
+	out    *bufio.Writer
+}
+
+// Browse the tree until the user quits
+func browse(tree ncduTree) error {
+	fd := int(os.Stdin.Fd())
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return err
+	}
+	defer term.Restore(fd, state)
+
+	b := &browser{tree: tree, dir: tree.Tree, sortBy: keySortSize, out: bufio.NewWriter(os.Stdout)}
+	// alternate screen, hidden cursor
+	fmt.Fprint(b.out, "\x1b[?1049h\x1b[?25l")
+	defer func() {
+		fmt.Fprint(b.out, "\x1b[?25h\x1b[?1049l")
+		b.out.Flush()
+	}()
+	buf := make([]byte, 16)
+	for {
+		b.sort()
+		err = b.render()
+		if err != nil {
+			return err
+		}
+		n, err := os.Stdin.Read(buf)
+		if err != nil {
+			return err
+		}
+		if !b.handle(parseKey(buf[:n])) {
+			return nil
+		}
+	}
+}
+
+func parseKey(in []byte) int {
+	switch string(in) {
+	case "\x1b[A", "\x1bOA", "k":
+		return keyUp
+	case "\x1b[B", "\x1bOB", "j":
+		return keyDown
+	case "\x1b[5~":
+		return keyPageUp
+	case "\x1b[6~":
+		return keyPageDown
+	case "\r", "\n", "\x1b[C", "\x1bOC", "l":
+		return keyOpen
+	case "\x1b[D", "\x1bOD", "h", "\x7f", "\b":
+		return keyParent
+	case "s":
+		return keySortSize
+	case "c":
+		return keySortCount
+	case "n":
+		return keySortName
+	case "q", "\x03":
+		return keyQuit
+	}
+	return keyNone
+}
+
+// Number of lines available for the directory entries
+func (b *browser) pageLines() int {
+	_, height, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil || height < 4 {
+		return 1
+	}
+	return height - 3
+}
+
+// Handle a key, returns false to quit
+func (b *browser) handle(key int) bool {
+	entries := b.dir.Children
+	switch key {
+	case keyUp:
+		b.cursor--
+	case keyDown:
+		b.cursor++
+	case keyPageUp:
+		b.cursor -= b.pageLines()
+	case keyPageDown:
+		b.cursor += b.pageLines()
+	case keyOpen:
+		if b.cursor < len(entries) && entries[b.cursor].Dir {
+			b.dir, b.cursor, b.offset = entries[b.cursor], 0, 0
+		}
+	case keyParent:
+		if b.dir.parent != nil {
+			from := b.dir
+			b.dir, b.cursor, b.offset = b.dir.parent, 0, 0
+			b.sort()
+			for i, c := range b.dir.Children {
+				if c == from {
+					b.cursor = i
+				}
+			}
+		}
+	case keySortSize, keySortCount, keySortName:
+		b.sortBy = key
+	case keyQuit:
+		return false
+	}
+	if b.cursor >= len(b.dir.Children) {
+		b.cursor = len(b.dir.Children) - 1
+	}
+	if b.cursor < 0 {
+		b.cursor = 0
+	}
+	return true
+}
+
+// Sort the entries of the current directory
+func (b *browser) sort() {
+	entries := b.dir.Children
+	sort.SliceStable(entries, func(i, j int) bool {
+		switch b.sortBy {
+		case keySortCount:
+			if entries[i].Count != entries[j].Count {
+				return entries[i].Count > entries[j].Count
+			}
+		case keySortSize:
+			if entries[i].Size != entries[j].Size {
+				return entries[i].Size > entries[j].Size
+			}
+		}
+		return entries[i].Name < entries[j].Name
+	})
+}
+
+// Path of the current directory
+func (b *browser) path() string {
+	var names []string
+	for n := b.dir; n.parent != nil; n = n.parent {
+		names = append([]string{n.Name}, names...)
+	}
+	if len(names) == 0 {
+		return b.tree.Root
+	}
+	return strings.TrimSuffix(b.tree.Root, "/") + "/" + path.Join(names...)
+}
+
+func (b *browser) render() error {
+	width, _, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil || width < 20 {
+		width = 80
+	}
+	lines := b.pageLines()
+	if b.cursor < b.offset {
+		b.offset = b.cursor
+	}
+	if b.cursor >= b.offset+lines {
+		b.offset = b.cursor - lines + 1
+	}
+	sortNames := map[int]string{keySortSize: "size", keySortCount: "files", keySortName: "name"}
+
+	fmt.Fprint(b.out, "\x1b[H\x1b[2J")
+	b.line(width, fmt.Sprintf("miria ncdu: %s (sorted by %s)", b.path(), sortNames[b.sortBy]), true)
+	b.line(width, "", false)
+	entries := b.dir.Children
+	for i := b.offset; i < len(entries) && i < b.offset+lines; i++ {
+		e := entries[i]
+		bar := 0
+		if b.dir.Size > 0 {
+			bar = int((e.Size*browserBarWidth + b.dir.Size - 1) / b.dir.Size)
+		}
+		name := printable(e.Name)
+		if e.Dir {
+			name += "/"
+		}
+		text := fmt.Sprintf("%10s %8d [%-*s] %s", log.SizeString(log.ByteSize(e.Size)), e.Count,
+			browserBarWidth, strings.Repeat("#", bar), name)
+		b.line(width, text, i == b.cursor)
+	}
+	for i := len(entries) - b.offset; i < lines; i++ {
+		b.line(width, "", false)
+	}
+	fmt.Fprintf(b.out, "\x1b[7m%s\x1b[0m", b.pad(width, fmt.Sprintf(" Total: %s, %d files   q:quit s/c/n:sort",
+		log.SizeString(log.ByteSize(b.dir.Size)), b.dir.Count)))
+	return b.out.Flush()
+}
+
+// Text truncated or padded to the terminal width
+func (b *browser) pad(width int, text string) string {
+	r := []rune(text)
+	if len(r) > width {
+		return string(r[:width])
+	}
+	return text + strings.Repeat(" ", width-len(r))
+}
+
+func (b *browser) line(width int, text string, reverse bool) {
+	if reverse {
+		fmt.Fprintf(b.out, "\x1b[7m%s\x1b[0m\r\n", b.pad(width, text))
+	} else {
+		fmt.Fprintf(b.out, "%s\r\n", b.pad(width, text))
+	}
+}
+
+// Name with control characters replaced by '?', as they would break the screen
+func printable(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r < ' ' || r == 0x7f {
+			return '?'
+		}
+		return r
+	}, name)
+}
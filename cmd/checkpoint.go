@@ -0,0 +1,277 @@
+/*
+Copyright © 2022 Antonin Portelli <antonin.portelli@me.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	log "github.com/aportelli/golog"
+	"github.com/aportelli/miria-cli/client"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// Minimum time between two checkpoint saves
+const checkpointInterval = 30 * time.Second
+
+// State of an interrupted scan. Count is the number of instances scanned,
+// Bytes the total size and Offset the number of results output so far, of
+// which Dirs are directories, backed up between Earliest and Latest. Totals
+// are the directory sizes of du. Selected is the size of the part of the
+// selection journal matching the state, see selectionFile.
+type checkpoint struct {
+	Command  string            `json:"command"`
+	Args     []string          `json:"args"`
+	Cursor   string            `json:"cursor"`
+	Count    uint64            `json:"count"`
+	Bytes    uint64            `json:"bytes"`
+	Offset   uint64            `json:"offset"`
+	Dirs     uint64            `json:"dirs"`
+	Earliest time.Time         `json:"earliest"`
+	Latest   time.Time         `json:"latest"`
+	Totals   map[string]uint64 `json:"totals,omitempty"`
+	Selected int64             `json:"selected,omitempty"`
+	Started  time.Time         `json:"started"`
+	Saved    time.Time         `json:"saved"`
+}
+
+type checkpointFlags struct {
+	File     string
+	Resume   string
+	printed  bool // results are printed during the scan
+	state    checkpoint
+	last     time.Time
+	restored []client.SearchResult // instances selected before the resumed checkpoint
+	pending  []client.SearchResult // instances selected since the last save
+}
+
+func addCheckpointFlags(cmd *cobra.Command, f *checkpointFlags) {
+	cmd.Flags().StringVar(&f.File, "checkpoint", "", "periodically save the scan state to file")
+	cmd.Flags().StringVar(&f.Resume, "resume", "",
+		"resume an interrupted scan from a checkpoint file (other arguments are ignored)")
+}
+
+// Positional arguments are not required when resuming
+func resumableArgs(args cobra.PositionalArgs) cobra.PositionalArgs {
+	return func(cmd *cobra.Command, a []string) error {
+		if cmd.Flags().Changed("resume") {
+			return nil
+		}
+		return args(cmd, a)
+	}
+}
+
+// Command-line arguments reproducing the current command, without
+// checkpointing and inherited flags
+func commandArgs(cmd *cobra.Command, args []string) []string {
+	var out []string
+
+	cmd.Flags().Visit(func(f *pflag.Flag) {
+		if f.Name == "checkpoint" || f.Name == "resume" || cmd.InheritedFlags().Lookup(f.Name) != nil {
+			return
+		}
+		if sv, ok := f.Value.(pflag.SliceValue); ok {
+			for _, v := range sv.GetSlice() {
+				out = append(out, "--"+f.Name+"="+v)
+			}
+		} else {
+			out = append(out, "--"+f.Name+"="+f.Value.String())
+		}
+	})
+	dash := cmd.ArgsLenAtDash()
+	if dash < 0 {
+		return append(out, args...)
+	}
+	out = append(out, args[:dash]...)
+	out = append(out, "--")
+	return append(out, args[dash:]...)
+}
+
+// Load the checkpoint if resuming and restore the command-line arguments,
+// returns the positional arguments to use
+func (f *checkpointFlags) init(cmd *cobra.Command, args []string) ([]string, error) {
+	if f.Resume == "" {
+		f.state = checkpoint{Command: cmd.Name(), Args: commandArgs(cmd, args), Started: time.Now()}
+		dateReference = f.state.Started
+		return args, nil
+	}
+	buf, err := os.ReadFile(f.Resume)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(buf, &f.state)
+	if err != nil {
+		return nil, fmt.Errorf("invalid checkpoint file '%s': %s", f.Resume, err.Error())
+	}
+	if f.state.Command != cmd.Name() {
+		return nil, fmt.Errorf("checkpoint file '%s' is for the %s command", f.Resume, f.state.Command)
+	}
+	// relative dates must be resolved as in the original scan
+	dateReference = f.state.Started
+	err = cmd.Flags().Parse(f.state.Args)
+	if err != nil {
+		return nil, err
+	}
+	if f.File == "" {
+		f.File = f.Resume
+	}
+	f.restored, err = readSelection(selectionFile(f.Resume), f.state.Selected)
+	if err != nil {
+		return nil, err
+	}
+	if f.File != f.Resume {
+		// the journal of the new checkpoint file starts with the restored
+		// instances
+		f.pending = f.restored
+		f.state.Selected = 0
+	}
+	log.Inf.Printf("Resuming scan saved on %s after %d results", f.state.Saved.Format(time.RFC3339),
+		f.state.Offset)
+	return cmd.Flags().Args(), nil
+}
+
+func (f *checkpointFlags) enabled() bool {
+	return f.File != ""
+}
+
+// Journal of the instances selected by a scan keeping only some instances of
+// each object, saved next to the checkpoint file. Instances are appended as
+// JSON lines when the checkpoint is saved, so that a save only writes the
+// instances selected since the previous one. Reading them in order restores
+// the selection.
+func selectionFile(file string) string {
+	return file + ".selected"
+}
+
+// Read the first size bytes of a selection journal
+func readSelection(file string, size int64) ([]client.SearchResult, error) {
+	var selected []client.SearchResult
+
+	if size == 0 {
+		return nil, nil
+	}
+	r, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	dec := json.NewDecoder(io.LimitReader(r, size))
+	for {
+		var s client.SearchResult
+		err = dec.Decode(&s)
+		if err == io.EOF {
+			return selected, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid selection journal '%s': %s", file, err.Error())
+		}
+		selected = append(selected, s)
+	}
+}
+
+// Append the pending instances to the selection journal, after the part
+// matching the last saved state. Anything written after it, e.g. by a save
+// interrupted before the checkpoint file was replaced, is discarded.
+func (f *checkpointFlags) saveSelection() error {
+	if len(f.pending) == 0 {
+		return nil
+	}
+	w, err := os.OpenFile(selectionFile(f.File), os.O_WRONLY|os.O_CREATE, 0666)
+	if err != nil {
+		return err
+	}
+	err = w.Truncate(f.state.Selected)
+	if err == nil {
+		_, err = w.Seek(f.state.Selected, io.SeekStart)
+	}
+	buf := bufio.NewWriter(w)
+	enc := json.NewEncoder(buf)
+	for i := 0; err == nil && i < len(f.pending); i++ {
+		err = enc.Encode(f.pending[i])
+	}
+	if err == nil {
+		err = buf.Flush()
+	}
+	var size int64
+	if err == nil {
+		size, err = w.Seek(0, io.SeekCurrent)
+	}
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	f.state.Selected = size
+	f.pending = nil
+	return nil
+}
+
+// Save the checkpoint atomically, at most every checkpointInterval unless
+// force is true. The saved state always matches the results already output.
+func (f *checkpointFlags) save(force bool) error {
+	if !f.enabled() || (!force && time.Since(f.last) < checkpointInterval) {
+		return nil
+	}
+	f.last = time.Now()
+	f.state.Saved = f.last
+	err := f.saveSelection()
+	if err != nil {
+		return err
+	}
+	buf, err := json.Marshal(f.state)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(f.File), filepath.Base(f.File)+".*")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(buf)
+	if err == nil {
+		err = tmp.Close()
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	log.Inf.Printf("Checkpoint saved to '%s'", f.File)
+	return os.Rename(tmp.Name(), f.File)
+}
+
+// Remove checkpoint file once the scan is complete
+func (f *checkpointFlags) done() error {
+	if !f.enabled() {
+		return nil
+	}
+	// nothing is saved if the scan completes before the first checkpoint
+	for _, file := range []string{selectionFile(f.File), f.File} {
+		err := os.Remove(file)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
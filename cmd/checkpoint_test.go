@@ -0,0 +1,67 @@
+/*
+Copyright © 2022 Antonin Portelli <antonin.portelli@me.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"os"
+	"testing"
+
+	"github.com/aportelli/miria-cli/client"
+)
+
+func TestCheckpointSelection(t *testing.T) {
+	f := checkpointFlags{File: t.TempDir() + "/scan.json"}
+	paths := []string{"archive@p:/a", "archive@p:/b", "archive@p:/c"}
+	selected := func(paths ...string) {
+		for _, p := range paths {
+			f.pending = append(f.pending, client.SearchResult{ObjectPath: p})
+		}
+	}
+	selected(paths[:2]...)
+	if err := f.save(true); err != nil {
+		t.Fatalf("first save: %s", err)
+	}
+	// only the new instances are written by the next save
+	selected(paths[2])
+	if err := f.save(true); err != nil {
+		t.Fatalf("second save: %s", err)
+	}
+	// instances written after the saved state are ignored and overwritten
+	w, err := os.OpenFile(selectionFile(f.File), os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.WriteString(`{"objectPath": "archive@p:/x"}` + "\n")
+	w.Close()
+	got, err := readSelection(selectionFile(f.File), f.state.Selected)
+	if err != nil || len(got) != len(paths) {
+		t.Fatalf("got %v, error %v, want %d instances", got, err, len(paths))
+	}
+	for i, r := range got {
+		if r.ObjectPath != paths[i] {
+			t.Errorf("instance %d: got %s, want %s", i, r.ObjectPath, paths[i])
+		}
+	}
+	if err := f.done(); err != nil {
+		t.Fatalf("done: %s", err)
+	}
+	for _, file := range []string{f.File, selectionFile(f.File)} {
+		if _, err := os.Stat(file); !os.IsNotExist(err) {
+			t.Errorf("%s not removed after the scan", file)
+		}
+	}
+}
@@ -90,7 +90,7 @@ var configGetCmd = &cobra.Command{
 	},
 }
 
-var options = []string{"host"}
+var options = []string{"host", "concurrency", "page-size"}
 
 func init() {
 	rootCmd.AddCommand(configCmd)
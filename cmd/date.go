@@ -0,0 +1,143 @@
+/*
+Copyright © 2022 Antonin Portelli <antonin.portelli@me.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/aportelli/miria-cli/client"
+	"github.com/spf13/cobra"
+)
+
+type dateFlags struct {
+	Since string
+	Until string
+	Newer string
+	Older string
+	AsOf  string
+}
+
+var relativeDateRegexp = regexp.MustCompile(`^(\d+)([hdwmy])$`)
+
+// Reference for relative dates, the current time if zero
+var dateReference time.Time
+
+// Parse absolute (2006-01-02[T15:04:05]) or relative (2y, 6m, 3w, 10d, 12h) dates
+func parseDate(date string) (time.Time, error) {
+	if m := relativeDateRegexp.FindStringSubmatch(date); m != nil {
+		n, _ := strconv.Atoi(m[1])
+		now := dateReference
+		if now.IsZero() {
+			now = time.Now()
+		}
+		switch m[2] {
+		case "h":
+			return now.Add(-time.Duration(n) * time.Hour), nil
+		case "d":
+			return now.AddDate(0, 0, -n), nil
+		case "w":
+			return now.AddDate(0, 0, -7*n), nil
+		case "m":
+			return now.AddDate(0, -n, 0), nil
+		case "y":
+			return now.AddDate(-n, 0, 0), nil
+		}
+	}
+	t, err := client.ParseBackupDate(date)
+	if err != nil {
+		return t, fmt.Errorf("invalid date '%s' (expected YYYY-MM-DD[THH:MM:SS] or <n>[hdwmy])", date)
+	}
+	return t, nil
+}
+
+// Same as parseDate, but use the modification time if date is a local file
+func parseDateOrFile(date string) (time.Time, error) {
+	if info, err := os.Stat(date); err == nil {
+		return info.ModTime(), nil
+	}
+	return parseDate(date)
+}
+
+// Resolve date flags into find options, keeping the most restrictive bounds
+func (f dateFlags) apply(opt *client.FindOptions) error {
+	since := func(t time.Time) {
+		if opt.Since.IsZero() || t.After(opt.Since) {
+			opt.Since = t
+		}
+	}
+	until := func(t time.Time) {
+		if opt.Until.IsZero() || t.Before(opt.Until) {
+			opt.Until = t
+		}
+	}
+	if f.Since != "" {
+		t, err := parseDate(f.Since)
+		if err != nil {
+			return err
+		}
+		since(t)
+	}
+	if f.Newer != "" {
+		t, err := parseDateOrFile(f.Newer)
+		if err != nil {
+			return err
+		}
+		since(t)
+	}
+	if f.Until != "" {
+		t, err := parseDate(f.Until)
+		if err != nil {
+			return err
+		}
+		// a plain day is inclusive
+		if len(f.Until) == len("2006-01-02") {
+			t = t.AddDate(0, 0, 1)
+		}
+		until(t)
+	}
+	if f.Older != "" {
+		t, err := parseDateOrFile(f.Older)
+		if err != nil {
+			return err
+		}
+		until(t)
+	}
+	if f.AsOf != "" {
+		t, err := parseDate(f.AsOf)
+		if err != nil {
+			return err
+		}
+		// a plain day is inclusive
+		if len(f.AsOf) == len("2006-01-02") {
+			t = t.AddDate(0, 0, 1).Add(-time.Second)
+		}
+		opt.AsOf = t
+	}
+	return nil
+}
+
+func addDateFlags(cmd *cobra.Command, f *dateFlags) {
+	cmd.Flags().StringVar(&f.Since, "since", "", "only backups from this date (YYYY-MM-DD or relative, e.g. 3m)")
+	cmd.Flags().StringVar(&f.Until, "until", "", "only backups before this date (YYYY-MM-DD or relative, e.g. 1y)")
+	cmd.Flags().StringVar(&f.Newer, "newer", "", "only backups newer than a date, a relative age or a local file mtime")
+	cmd.Flags().StringVar(&f.Older, "older", "", "only backups older than a date, a relative age or a local file mtime")
+	cmd.Flags().StringVar(&f.AsOf, "as-of", "", "only consider instances current at this date (implies --versions latest)")
+}
@@ -0,0 +1,59 @@
+/*
+Copyright © 2022 Antonin Portelli <antonin.portelli@me.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDate(t *testing.T) {
+	dateReference = time.Date(2026, 3, 31, 12, 0, 0, 0, time.Local)
+	defer func() { dateReference = time.Time{} }()
+	tests := []struct {
+		date string
+		want time.Time
+	}{
+		{"12h", time.Date(2026, 3, 31, 0, 0, 0, 0, time.Local)},
+		{"10d", time.Date(2026, 3, 21, 12, 0, 0, 0, time.Local)},
+		{"3w", time.Date(2026, 3, 10, 12, 0, 0, 0, time.Local)},
+		{"1m", time.Date(2026, 3, 3, 12, 0, 0, 0, time.Local)}, // February 31st normalised
+		{"6m", time.Date(2025, 10, 1, 12, 0, 0, 0, time.Local)},
+		{"2y", time.Date(2024, 3, 31, 12, 0, 0, 0, time.Local)},
+		{"0d", dateReference},
+		{"2026-01-02", time.Date(2026, 1, 2, 0, 0, 0, 0, time.Local)},
+		{"2026-01-02T03:04:05", time.Date(2026, 1, 2, 3, 4, 5, 0, time.Local)},
+	}
+	for _, tt := range tests {
+		got, err := parseDate(tt.date)
+		if err != nil {
+			t.Errorf("parseDate(%q): %s", tt.date, err)
+			continue
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("parseDate(%q): got %s, want %s", tt.date, got, tt.want)
+		}
+	}
+}
+
+func TestParseDateErrors(t *testing.T) {
+	for _, date := range []string{"", "d", "10", "10x", "-1d", "1.5y", "2026-13-01", "yesterday"} {
+		if _, err := parseDate(date); err == nil {
+			t.Errorf("parseDate(%q): expected an error", date)
+		}
+	}
+}
@@ -17,7 +17,12 @@ along with this program. If not, see <http://www.gnu.org/licenses/>.
 package cmd
 
 import (
+	"context"
 	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
 
 	log "github.com/aportelli/golog"
 	"github.com/aportelli/miria-cli/client"
@@ -26,54 +31,266 @@ import (
 
 // duCmd represents the du command
 var duCmd = &cobra.Command{
-	Use:   "du <path>",
-	Short: "Show total size contained in a given path",
-	Long: `Show total size contained in a given path, mimicking the ` + "`du -s`" + ` Unix command.
-Miria does not have a direct interface to query directory sizes, this command 
-will perform a full scan similar to the ` + "`find`" + ` command, and might take time 
-for large directories.`,
-	Args: cobra.ExactArgs(1),
+	Use:   "du <path>...",
+	Short: "Show size of the directories in the given paths",
+	Long: `Show the total size of each directory in a given path, mimicking the ` + "`du`" + `
+Unix command. Miria does not have a direct interface to query directory sizes,
+this command will perform a full scan similar to the ` + "`find`" + ` command, and might
+take time for large directories. Sizes of all directories are computed from a
+single scan, subdirectories are printed before their parent, up to --max-depth
+levels below the path, or only the total with -s. Directories without archived
+files are not shown.
+
+Several paths are scanned concurrently, up to ` + "`concurrency`" + ` at a time (see
+` + "`miria config`" + `), and printed in argument order. Use -c to also print their
+grand total. Paths that do not exist are reported as errors, and the command
+then exits with a non-zero status after printing the other paths.
+
+By default, only the latest instance of each file is counted, which gives the
+logical size of the directory (--apparent-size). Use --all-instances to sum the
+sizes of all archived instances, which gives the tape consumption, or --versions
+for other selections. With --inodes, the number of files and directories is
+shown instead of their size.
+
+With --checkpoint, the scan state is saved to a file every 30 seconds, and an
+interrupted scan can be continued with --resume. The instances selected with
+--versions latest or first are appended to a journal next to it, with the
+.selected suffix, so that each save only writes the new ones.
+
+With --index, sizes are computed from the local index containing the path (see
+` + "`miria index`" + `) instead of scanning the archive.
+
+Example:
+  miria du archive@project:/dir -H --max-depth 1
+  miria du -sc archive@project:/dir1 archive@other:/dir2
+  miria du archive@project:/dir --inodes --all-instances -d 1
+  miria du archive@project:/dir -s --since 2026-07-01 --until 2026-09-30
+  miria du archive@project:/dir --exclude scratch --prune '*.zarr'
+  miria du archive@project:/dir --index
+  miria du archive@project:/dir --checkpoint du.json
+  miria du --resume du.json`,
+	Args: resumableArgs(cobra.MinimumNArgs(1)),
 	Run: func(cmd *cobra.Command, args []string) {
-		AuthenticateIfNecessary()
-		var total uint64 = 0
-		findOpt.Opt.Path = args[0]
-		cout := make(chan []client.SearchResult)
-		cerr := make(chan error)
-		go miria.Find(findOpt.Opt, cout, cerr)
-	out:
-		for {
-			select {
-			case err := <-cerr:
-				log.ErrorCheck(err, "")
-				return
-			case buf := <-cout:
-				if buf == nil {
-					break out
-				} else {
-					for _, r := range buf {
-						total += r.ObjectSize
-					}
-				}
+		args, err := duOpt.Checkpoint.init(cmd, args)
+		log.ErrorCheck(err, "")
+		err = applyDuMode(cmd)
+		log.ErrorCheck(err, "")
+		if len(args) > 1 && duOpt.Checkpoint.enabled() {
+			log.Err.Fatalln("several paths cannot be scanned with --checkpoint")
+		}
+		scans := make([]*duScan, len(args))
+		for i, p := range args {
+			s := &duScan{opt: duOpt.Opt, ck: &duOpt.Checkpoint, done: make(chan struct{})}
+			if i > 0 {
+				s.ck = &checkpointFlags{}
+			}
+			err = duOpt.Scan.apply(&s.opt, p)
+			log.ErrorCheck(err, "")
+			scans[i] = s
+		}
+
+		// scan concurrently, but print in argument order
+		go func() {
+			slots := make(chan struct{}, miria.Concurrency())
+			for _, s := range scans {
+				slots <- struct{}{}
+				go func(s *duScan) {
+					defer func() { <-slots }()
+					s.run()
+				}(s)
+			}
+		}()
+		var total uint64
+		failed := false
+		for _, s := range scans {
+			<-s.done
+			if s.err != nil {
+				log.Err.Printf("%s: %s", s.opt.Path, s.err.Error())
+				failed = true
+				continue
 			}
+			s.print()
+			total += s.total
 		}
-		var size string
-		if findOpt.Humanize {
-			size = log.SizeString(log.ByteSize(total))
-		} else {
-			size = fmt.Sprint(total)
+		if duOpt.Total {
+			log.Msg.Printf("%s total", duString(total))
+		}
+		if failed {
+			os.Exit(1)
 		}
-		log.Msg.Printf("%s %s", size, findOpt.Opt.Path)
 	},
 }
 
 var duOpt = struct {
-	Opt      client.FindOptions
-	Humanize bool
-}{client.FindOptions{Path: "", Type: "f", Pattern: "*"}, false}
+	Opt          client.FindOptions
+	Humanize     bool
+	Scan         scanFlags
+	Checkpoint   checkpointFlags
+	Summarize    bool
+	MaxDepth     int
+	Total        bool
+	Inodes       bool
+	ApparentSize bool
+	AllInstances bool
+}{client.FindOptions{Path: "", Type: "f", Pattern: "*", MaxDepth: -1,
+	Versions: client.VersionsLatest}, false, scanFlags{}, checkpointFlags{}, false, -1, false, false, false,
+	false}
 
 func init() {
 	rootCmd.AddCommand(duCmd)
-	duCmd.Flags().BoolVarP(&findOpt.Humanize, "human-readable", "H", false,
+	duCmd.Flags().BoolVarP(&duOpt.Humanize, "human-readable", "H", false,
 		"human-readable sizes")
 	duCmd.Flags().Lookup("human-readable").NoOptDefVal = "true"
+	duCmd.Flags().BoolVarP(&duOpt.Summarize, "summarize", "s", false, "only print the total size")
+	duCmd.Flags().BoolVarP(&duOpt.Total, "total", "c", false, "print the grand total of all paths")
+	duCmd.Flags().IntVarP(&duOpt.MaxDepth, "max-depth", "d", -1,
+		"only print directories up to this depth below the path (-1 is unlimited)")
+	duCmd.Flags().StringVar(&duOpt.Opt.Versions, "versions", client.VersionsLatest,
+		"instances to count for each file (all, latest or first)")
+	duCmd.Flags().BoolVar(&duOpt.Inodes, "inodes", false, "count files and directories instead of sizes")
+	duCmd.Flags().BoolVar(&duOpt.ApparentSize, "apparent-size", false,
+		"count the latest instance of each file, i.e. the logical size (default)")
+	duCmd.Flags().BoolVar(&duOpt.AllInstances, "all-instances", false,
+		"count all instances of each file, i.e. the tape consumption")
+	addScanFlags(duCmd, &duOpt.Scan, "sum sizes from the local index (see 'miria index')")
+	addCheckpointFlags(duCmd, &duOpt.Checkpoint)
+}
+
+// Apply the accounting mode flags to the search options
+func applyDuMode(cmd *cobra.Command) error {
+	if duOpt.ApparentSize || duOpt.AllInstances {
+		if duOpt.ApparentSize && duOpt.AllInstances {
+			return fmt.Errorf("--apparent-size and --all-instances cannot be used together")
+		}
+		if cmd.Flags().Changed("versions") {
+			return fmt.Errorf("--versions cannot be used with --apparent-size or --all-instances")
+		}
+	}
+	if duOpt.ApparentSize {
+		duOpt.Opt.Versions = client.VersionsLatest
+	}
+	if duOpt.AllInstances {
+		duOpt.Opt.Versions = client.VersionsAll
+	}
+	if duOpt.Inodes {
+		// directories are counted too
+		duOpt.Opt.Type = ""
+	}
+	return nil
+}
+
+// Size, or number of files and directories with --inodes
+func duString(v uint64) string {
+	if duOpt.Inodes {
+		return strconv.FormatUint(v, 10)
+	}
+	return sizeString(v, duOpt.Humanize)
+}
+
+// Scan of one path, done is closed once the scan is complete
+type duScan struct {
+	opt    client.FindOptions
+	ck     *checkpointFlags
+	totals duTotals // nil if only the total is printed
+	total  uint64
+	err    error
+	done   chan struct{}
+}
+
+func (s *duScan) run() {
+	defer close(s.done)
+	var state checkpoint
+
+	if duOpt.Summarize || duOpt.MaxDepth == 0 {
+		state, s.err = runScan(s.opt, s.ck, func([]client.SearchResult) error {
+			return nil
+		})
+	} else {
+		state, s.err = s.scanTotals()
+	}
+	s.total = state.Bytes
+	if duOpt.Inodes {
+		s.total = state.Offset
+	}
+	if s.err == nil && state.Offset == 0 {
+		// nothing was counted, the path may not exist
+		exists, err := miria.Exists(context.Background(), s.opt.Path, s.opt.Index)
+		switch {
+		case err != nil:
+			s.err = err
+		case !exists:
+			s.err = fmt.Errorf("no such file or directory")
+		}
+	}
+}
+
+// Scan the path, aggregating the totals of each directory
+func (s *duScan) scanTotals() (checkpoint, error) {
+	root := client.CleanObjectPath(s.opt.Path)
+	if s.ck.state.Totals == nil {
+		s.ck.state.Totals = make(map[string]uint64)
+	}
+	s.totals = duTotals(s.ck.state.Totals)
+	state, err := runScan(s.opt, s.ck, func(results []client.SearchResult) error {
+		for _, r := range results {
+			if !duOpt.Inodes {
+				s.totals.add(root, r.ObjectPath, r.ObjectSize)
+				continue
+			}
+			s.totals.add(root, r.ObjectPath, 1)
+			if r.IsDir() && r.ObjectPath != root && client.UnderPath(r.ObjectPath, root) {
+				// a directory counts in its own total
+				s.totals[r.ObjectPath]++
+			}
+		}
+		return nil
+	})
+	if _, ok := s.totals[root]; !ok {
+		// the path itself is always shown
+		s.totals[root] = 0
+	}
+	return state, err
+}
+
+func (s *duScan) print() {
+	if s.totals == nil {
+		log.Msg.Printf("%s %s", duString(s.total), s.opt.Path)
+		return
+	}
+	rootDepth := client.PathDepth(s.opt.Path)
+	for _, dir := range s.totals.sorted() {
+		if duOpt.MaxDepth < 0 || client.PathDepth(dir)-rootDepth <= duOpt.MaxDepth {
+			log.Msg.Printf("%s %s", duString(s.totals[dir]), dir)
+		}
+	}
+}
+
+// Directory sizes, aggregated from the scanned files
+type duTotals map[string]uint64
+
+// Add size to root and every directory between root and the parent of p
+func (t duTotals) add(root string, p string, size uint64) {
+	t[root] += size
+	for dir := client.ParentPath(p); dir != root && client.UnderPath(dir, root); dir = client.ParentPath(dir) {
+		t[dir] += size
+	}
+}
+
+// Directories in du order, subdirectories before their parent
+func (t duTotals) sorted() []string {
+	dirs := make([]string, 0, len(t))
+	for dir := range t {
+		dirs = append(dirs, dir)
+	}
+	sort.Slice(dirs, func(i, j int) bool {
+		a := strings.Split(strings.TrimSuffix(dirs[i], "/"), "/")
+		b := strings.Split(strings.TrimSuffix(dirs[j], "/"), "/")
+		for k := 0; k < len(a) && k < len(b); k++ {
+			if a[k] != b[k] {
+				return a[k] < b[k]
+			}
+		}
+		return len(a) > len(b)
+	})
+	return dirs
 }
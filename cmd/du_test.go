@@ -0,0 +1,76 @@
+/*
+Copyright © 2022 Antonin Portelli <antonin.portelli@me.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDuTotals(t *testing.T) {
+	root := "archive@p:/data"
+	totals := make(duTotals)
+	files := []struct {
+		path string
+		size uint64
+	}{
+		{"archive@p:/data/a/x.h5", 1},
+		{"archive@p:/data/a/b/y.h5", 2},
+		{"archive@p:/data/a-b/z.h5", 4},
+		{"archive@p:/data/c.h5", 8},
+		{"archive@p:/data/a/b/c/w.h5", 16},
+	}
+	for _, f := range files {
+		totals.add(root, f.path, f.size)
+	}
+	want := map[string]uint64{
+		"archive@p:/data":       31,
+		"archive@p:/data/a":     19,
+		"archive@p:/data/a/b":   18,
+		"archive@p:/data/a/b/c": 16,
+		"archive@p:/data/a-b":   4,
+	}
+	if !reflect.DeepEqual(map[string]uint64(totals), want) {
+		t.Errorf("got totals %v, want %v", totals, want)
+	}
+}
+
+func TestDuTotalsSorted(t *testing.T) {
+	tests := []struct {
+		dirs []string
+		want []string
+	}{
+		// subdirectories before their parent, siblings in name order
+		{[]string{"archive@p:/data", "archive@p:/data/a", "archive@p:/data/a/b", "archive@p:/data/c"},
+			[]string{"archive@p:/data/a/b", "archive@p:/data/a", "archive@p:/data/c", "archive@p:/data"}},
+		// paths are compared by component, so a/b comes with a, before a-b
+		{[]string{"archive@p:/data/a-b", "archive@p:/data/a", "archive@p:/data/a/b", "archive@p:/data"},
+			[]string{"archive@p:/data/a/b", "archive@p:/data/a", "archive@p:/data/a-b", "archive@p:/data"}},
+		// archive root
+		{[]string{"archive@p:/", "archive@p:/b", "archive@p:/a"},
+			[]string{"archive@p:/a", "archive@p:/b", "archive@p:/"}},
+	}
+	for _, tt := range tests {
+		totals := make(duTotals)
+		for _, dir := range tt.dirs {
+			totals[dir] = 0
+		}
+		if got := totals.sorted(); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%v: got %v, want %v", tt.dirs, got, tt.want)
+		}
+	}
+}
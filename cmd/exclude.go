@@ -0,0 +1,80 @@
+/*
+Copyright © 2022 Antonin Portelli <antonin.portelli@me.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"bufio"
+	"os"
+	"strings"
+
+	"github.com/aportelli/miria-cli/client"
+	"github.com/spf13/cobra"
+)
+
+type pathFlags struct {
+	Path        string
+	IPath       string
+	Exclude     []string
+	ExcludeFrom []string
+	Prune       []string
+}
+
+// Read exclusion patterns from file, one per line, ignoring blank lines and
+// lines starting with '#'
+func readPatterns(filename string) ([]string, error) {
+	var patterns []string
+
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			patterns = append(patterns, line)
+		}
+	}
+	return patterns, scanner.Err()
+}
+
+func (f pathFlags) apply(opt *client.FindOptions) error {
+	opt.PathPattern = f.Path
+	opt.IPathPattern = f.IPath
+	opt.Exclude = append([]string{}, f.Exclude...)
+	for _, filename := range f.ExcludeFrom {
+		patterns, err := readPatterns(filename)
+		if err != nil {
+			return err
+		}
+		opt.Exclude = append(opt.Exclude, patterns...)
+	}
+	opt.Prune = f.Prune
+	return nil
+}
+
+func addPathFlags(cmd *cobra.Command, f *pathFlags) {
+	cmd.Flags().StringVar(&f.Path, "path", "", "full object path pattern, with or without the archive prefix")
+	cmd.Flags().StringVar(&f.IPath, "ipath", "", "same as --path, case insensitive")
+	cmd.Flags().StringArrayVar(&f.Exclude, "exclude", nil,
+		"exclude paths matching pattern and their content (repeatable)")
+	cmd.Flags().StringArrayVar(&f.ExcludeFrom, "exclude-from", nil,
+		"read exclusion patterns from file (repeatable)")
+	cmd.Flags().StringArrayVar(&f.Prune, "prune", nil,
+		"do not descend into directories matching pattern (repeatable)")
+}
@@ -0,0 +1,258 @@
+/*
+Copyright © 2022 Antonin Portelli <antonin.portelli@me.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+
+	log "github.com/aportelli/golog"
+	"github.com/aportelli/miria-cli/client"
+)
+
+const execHelp = `Actions in the expression:
+  -exec cmd [args] ;     run cmd for each result, {} is replaced by its path
+  -exec cmd [args] {} +  run cmd with as many paths as possible at once
+  -execdir ...           same, but {} is replaced by the object name, relative
+                         to the archive directory in MIRIA_PARENT, and batches
+                         only contain objects of a single directory
+Actions must end the expression: they run on every result matching the rest of
+it, up to --jobs at a time, in the current directory, and disable the default
+output. Group alternatives with parentheses, e.g. \( -name a -o -name b \).
+For single results, the environment contains MIRIA_PATH, MIRIA_NAME, MIRIA_SIZE,
+MIRIA_TYPE, MIRIA_BACKUP_DATE, MIRIA_OBJECT_ID, MIRIA_INSTANCE_ID and
+MIRIA_REPOSITORY_ID. MIRIA_PARENT contains the archive directory with -execdir.
+The exit status is the one of the first failed command.`
+
+// Maximum total length of the paths in a batch
+const execBatchBytes = 128 * 1024
+
+// Command run on results, either one at a time or in batches
+type execAction struct {
+	argv    []string
+	dir     bool // -execdir
+	batch   bool // terminated by {} +
+	pending []client.SearchResult
+	size    int
+}
+
+// Primaries of the expression taking an argument
+var exprArgPrimaries = map[string]bool{"-name": true, "-path": true, "-ipath": true, "-type": true,
+	"-size": true}
+
+// Extract -exec and -execdir actions from expression tokens, returns the
+// remaining tokens. Actions run on every result matching the expression, so
+// they must be the last terms of the expression, ANDed at the top level.
+func parseExecActions(tokens []string) ([]string, []*execAction, error) {
+	var rest []string
+	var actions []*execAction
+
+	for i := 0; i < len(tokens); i++ {
+		t := tokens[i]
+		if t != "-exec" && t != "-execdir" {
+			if len(actions) > 0 && t != "-a" && t != "-and" {
+				return nil, nil, fmt.Errorf("'%s' after '%s': actions must end the expression",
+					t, actions[len(actions)-1].name())
+			}
+			rest = append(rest, t)
+			continue
+		}
+		a := &execAction{dir: t == "-execdir"}
+		end := -1
+		for j := i + 1; j < len(tokens); j++ {
+			if tokens[j] == ";" {
+				end = j
+				break
+			}
+			if tokens[j] == "+" && j > i+1 && tokens[j-1] == "{}" {
+				a.batch = true
+				end = j
+				break
+			}
+		}
+		if end < 0 {
+			return nil, nil, fmt.Errorf("missing ';' or '{} +' after '%s'", t)
+		}
+		a.argv = tokens[i+1 : end]
+		if a.batch {
+			a.argv = a.argv[:len(a.argv)-1]
+			for _, arg := range a.argv {
+				if strings.Contains(arg, "{}") {
+					return nil, nil, fmt.Errorf("'{}' can only appear once, before '+', in '%s'", t)
+				}
+			}
+		}
+		if len(a.argv) == 0 {
+			return nil, nil, fmt.Errorf("missing command after '%s'", t)
+		}
+		actions = append(actions, a)
+		i = end
+	}
+	// remove connectives left dangling by the removed actions
+	for len(rest) > 0 && (rest[len(rest)-1] == "-a" || rest[len(rest)-1] == "-and") {
+		rest = rest[:len(rest)-1]
+	}
+	if len(actions) == 0 {
+		return rest, actions, nil
+	}
+	depth, last := 0, ""
+	for i := 0; i < len(rest); i++ {
+		t := rest[i]
+		last = t
+		switch {
+		case exprArgPrimaries[t]:
+			// skip the argument, which could look like an operator
+			i++
+			last = ""
+		case t == "(":
+			depth++
+		case t == ")":
+			depth--
+		case depth == 0 && (t == "-o" || t == "-or"):
+			return nil, nil, fmt.Errorf("actions would only apply to the last alternative of '%s', "+
+				"group the alternatives with parentheses", t)
+		}
+	}
+	switch last {
+	case "!", "-not", "(", "-o", "-or":
+		return nil, nil, fmt.Errorf("'%s' before '%s': actions cannot be negated, grouped or "+
+			"alternatives", last, actions[0].name())
+	}
+	return rest, actions, nil
+}
+
+func (a *execAction) name() string {
+	if a.dir {
+		return "-execdir"
+	}
+	return "-exec"
+}
+
+// Argument substituted for {}, the object name relative to its archive
+// directory with -execdir
+func (a *execAction) target(r client.SearchResult) string {
+	if a.dir {
+		return r.ObjectName
+	}
+	return r.ObjectPath
+}
+
+// Add a result, running the command if a batch is full
+func (a *execAction) add(r client.SearchResult, x *execRunner) {
+	if !a.batch {
+		argv := make([]string, len(a.argv))
+		for i, arg := range a.argv {
+			argv[i] = strings.ReplaceAll(arg, "{}", a.target(r))
+		}
+		env := []string{
+			"MIRIA_PATH=" + r.ObjectPath,
+			"MIRIA_NAME=" + r.ObjectName,
+			"MIRIA_SIZE=" + strconv.FormatUint(r.ObjectSize, 10),
+			"MIRIA_TYPE=" + r.ObjectType,
+			"MIRIA_BACKUP_DATE=" + r.InstanceBackupDate,
+			"MIRIA_OBJECT_ID=" + strconv.Itoa(r.ObjectId),
+			"MIRIA_INSTANCE_ID=" + strconv.Itoa(r.InstanceId),
+			"MIRIA_REPOSITORY_ID=" + strconv.Itoa(r.RepositoryId),
+		}
+		if a.dir {
+			env = append(env, "MIRIA_PARENT="+client.ParentPath(r.ObjectPath))
+		}
+		x.run(argv, env)
+		return
+	}
+	if len(a.pending) > 0 && (a.size >= execBatchBytes ||
+		a.dir && client.ParentPath(r.ObjectPath) != client.ParentPath(a.pending[0].ObjectPath)) {
+		a.flush(x)
+	}
+	a.pending = append(a.pending, r)
+	a.size += len(a.target(r)) + 1
+}
+
+// Run the command on the pending batch
+func (a *execAction) flush(x *execRunner) {
+	if len(a.pending) == 0 {
+		return
+	}
+	argv := append([]string{}, a.argv...)
+	for _, r := range a.pending {
+		argv = append(argv, a.target(r))
+	}
+	var env []string
+	if a.dir {
+		env = append(env, "MIRIA_PARENT="+client.ParentPath(a.pending[0].ObjectPath))
+	}
+	a.pending = nil
+	a.size = 0
+	x.run(argv, env)
+}
+
+// Run commands with bounded parallelism //////////////////////////////////////
+type execRunner struct {
+	slots  chan struct{}
+	wg     sync.WaitGroup
+	mutex  sync.Mutex
+	status int
+}
+
+func newExecRunner(jobs int) *execRunner {
+	if jobs < 1 {
+		jobs = 1
+	}
+	return &execRunner{slots: make(chan struct{}, jobs)}
+}
+
+// Start a command once a slot is free, env is added to the current environment
+func (x *execRunner) run(argv []string, env []string) {
+	x.slots <- struct{}{}
+	x.wg.Add(1)
+	go func() {
+		defer x.wg.Done()
+		defer func() { <-x.slots }()
+		c := exec.Command(argv[0], argv[1:]...)
+		c.Env = append(os.Environ(), env...)
+		c.Stdin, c.Stdout, c.Stderr = nil, os.Stdout, os.Stderr
+		err := c.Run()
+		if err == nil {
+			return
+		}
+		status := 1
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			if exitErr.ExitCode() > 0 {
+				status = exitErr.ExitCode()
+			}
+		} else {
+			log.Err.Printf("cannot run '%s': %s", argv[0], err.Error())
+		}
+		x.mutex.Lock()
+		if x.status == 0 {
+			x.status = status
+		}
+		x.mutex.Unlock()
+	}()
+}
+
+// Wait for all commands, returns the status of the first failed one or 0
+func (x *execRunner) wait() int {
+	x.wg.Wait()
+	return x.status
+}
@@ -0,0 +1,105 @@
+/*
+Copyright © 2022 Antonin Portelli <antonin.portelli@me.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aportelli/miria-cli/client"
+)
+
+func TestParseExecActions(t *testing.T) {
+	tests := []struct {
+		expr    string
+		rest    string
+		argv    []string
+		dir     bool
+		batch   bool
+		actions int
+	}{
+		{"-name *.h5", "-name *.h5", nil, false, false, 0},
+		{"-name *.h5 -exec ls -l {} ;", "-name *.h5", []string{"ls", "-l", "{}"}, false, false, 1},
+		{"-name *.h5 -a -exec ls {} +", "-name *.h5", []string{"ls"}, false, true, 1},
+		{"-execdir echo {} ;", "", []string{"echo", "{}"}, true, false, 1},
+		{"( -name a -o -name b ) -exec echo {} ;", "( -name a -o -name b )", []string{"echo", "{}"},
+			false, false, 1},
+		{"-name -o -exec echo {} ;", "-name -o", []string{"echo", "{}"}, false, false, 1},
+		{"-exec echo a ; -exec echo b ;", "", []string{"echo", "a"}, false, false, 2},
+	}
+	for _, tt := range tests {
+		rest, actions, err := parseExecActions(strings.Fields(tt.expr))
+		if err != nil {
+			t.Errorf("parseExecActions(%q): %s", tt.expr, err)
+			continue
+		}
+		if got := strings.Join(rest, " "); got != tt.rest {
+			t.Errorf("parseExecActions(%q): got rest %q, want %q", tt.expr, got, tt.rest)
+		}
+		if len(actions) != tt.actions {
+			t.Errorf("parseExecActions(%q): got %d actions, want %d", tt.expr, len(actions), tt.actions)
+			continue
+		}
+		if tt.actions == 0 {
+			continue
+		}
+		a := actions[0]
+		if !reflect.DeepEqual(a.argv, tt.argv) || a.dir != tt.dir || a.batch != tt.batch {
+			t.Errorf("parseExecActions(%q): got %v (dir %v, batch %v), want %v (dir %v, batch %v)",
+				tt.expr, a.argv, a.dir, a.batch, tt.argv, tt.dir, tt.batch)
+		}
+	}
+}
+
+func TestParseExecActionsErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		err  string
+	}{
+		{"-exec ls {}", "missing ';' or '{} +' after '-exec'"},
+		{"-exec ;", "missing command after '-exec'"},
+		{"-exec ls {} {} +", "'{}' can only appear once, before '+', in '-exec'"},
+		{"-exec ls {} ; -name a", "'-name' after '-exec': actions must end the expression"},
+		{"-name a -o -exec ls {} ;", "actions would only apply to the last alternative"},
+		{"! -execdir ls {} ;", "'!' before '-execdir': actions cannot be negated"},
+		{"( -exec ls {} ; )", "')' after '-exec': actions must end the expression"},
+	}
+	for _, tt := range tests {
+		_, _, err := parseExecActions(strings.Fields(tt.expr))
+		if err == nil || !strings.HasPrefix(err.Error(), tt.err) {
+			t.Errorf("parseExecActions(%q): got error %v, want %q", tt.expr, err, tt.err)
+		}
+	}
+}
+
+func TestExecTarget(t *testing.T) {
+	r := client.SearchResult{ObjectPath: "archive@p:/data/a.h5", ObjectName: "a.h5"}
+	tests := []struct {
+		dir    bool
+		target string
+	}{
+		{false, "archive@p:/data/a.h5"},
+		{true, "a.h5"},
+	}
+	for _, tt := range tests {
+		a := &execAction{dir: tt.dir}
+		if got := a.target(r); got != tt.target {
+			t.Errorf("target() with dir %v: got %q, want %q", tt.dir, got, tt.target)
+		}
+	}
+}
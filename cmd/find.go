@@ -17,7 +17,7 @@ along with this program. If not, see <http://www.gnu.org/licenses/>.
 package cmd
 
 import (
-	"strings"
+	"os"
 
 	log "github.com/aportelli/golog"
 	"github.com/aportelli/miria-cli/client"
@@ -25,84 +25,243 @@ import (
 )
 
 var findCmd = &cobra.Command{
-	Use:   "find <path>",
+	Use:   "find [path] [flags] [-- expression]",
 	Short: "Find files in archive",
 	Long: `Find files in the tape archive, mimicking the ` + "`find`" + ` Unix command.
 
+Arguments after ` + "`--`" + ` form a GNU find-like expression, combined with the flags.
+Supported primaries are -name, -path, -ipath, -type and -size, which can be combined
+with -a/-and (implicit), -o/-or, !/-not and parentheses. Sizes are compared in
+bytes and accept the suffixes c, k, M, G, T and P. Criteria are sent to the 
+server where possible, the rest is evaluated client-side. Depth limits are also
+sent to the server, so that shallow queries do not scan the whole tree, unless
+the server rejects or ignores them, or returns nothing where the search without
+them finds results, in which case they are only checked client-side.
+
+All archived instances of an object are shown by default, use --versions to
+only keep the latest or first one, or --as-of to show the instances current at
+a given date. In these cases, results are only printed at the end of the search.
+
+Results are requested in pages of ` + "`page-size`" + ` (see ` + "`miria config`" + `) results,
+which can be overridden with --page-size. With --limit, the search stops as soon
+as enough results are printed, this requires all pages if only some versions
+are kept.
+
+With --index, the search runs on the local index containing the path (see
+` + "`miria index`" + `), or on all the local indexes of the host if no path is
+given, which can miss the latest backups.
+
+With --count, only the number of results and their total size are printed. With
+--summary, the output is followed by the number of files and directories, their
+total size and the range of backup dates. The summary goes to the standard error
+for structured outputs.
+
+Result pages are fetched ahead while the previous ones are printed. With --split,
+each subdirectory of the path is searched separately, with up to ` + "`concurrency`" + `
+(see ` + "`miria config`" + `) concurrent requests. Results are then grouped by
+subdirectory, in the order of the server listing. The search is not split if
+the server does not support depth criteria.
+
+With --checkpoint, the scan state is saved to a file after each printed page of
+results, or every 30 seconds if results are only printed at the end, and an
+interrupted scan can be continued with --resume, after the last printed result.
+The output of an interrupted scan is left unterminated, and the output of the
+resumed scan continues it, e.g. without CSV header or opening JSON bracket, so
+that both can be concatenated. Without --checkpoint, structured outputs are
+terminated on errors. The instances selected with --versions latest or first
+are appended to a journal next to the checkpoint file, with the .selected
+suffix, so that each save only writes the new ones.
+
+The repository storing each instance is shown in list and structured outputs,
+and --repository only keeps the instances stored in the given repositories (see
+` + "`miria repositories`" + `).
+
+Patterns given to --path and --ipath are matched against the full object path,
+with or without the archive prefix, e.g. '/dir/*.h5' or 'archive@project:/dir/*.h5'.
+Patterns given to --exclude and --prune without a '/' are matched against each
+path component below the searched path, others against each ancestor path below
+it. Excluded paths are skipped together with their content, pruned directories
+are shown but not their content.
+
+` + printfHelp + `
+
+` + execHelp + `
+
 Example:
-  miria find archive@project:/dir --name '*.txt'`,
-	Args: cobra.ExactArgs(1),
+  miria find archive@project:/dir --name '*.txt'
+  miria find archive@project:/dir --name '*.h5' --limit 10
+  miria find archive@project:/dir --name '*.h5' --count -H
+  miria find archive@project:/dir/sub --index --name 'run_0421*'
+  miria find --index --name 'run_0421*'
+  miria find archive@project:/dir --repository tapeA -l
+  miria find archive@project:/dir --since 2026-01-01 --until 2026-06-30
+  miria find archive@project:/dir --older 2y
+  miria find archive@project:/dir --as-of 2025-12-31
+  miria find archive@project:/dir --format ndjson | jq .objectSize
+  miria find archive@project:/dir --printf '%p\t%s\t%TY-%Tm-%Td\n'
+  miria find archive@project:/dir --print0 | xargs -0 -n 1 echo
+  miria find archive@project:/dir --exclude tmp --exclude-from ~/.miria-exclude
+  miria find archive@project:/dir --path '*/sub/*.h5' --prune deep
+  miria find archive@project:/dir -- \( -name '*.h5' -o -name '*.nc' \) ! -path '*/tmp/*'
+  miria find archive@project:/dir -j 4 -- -name '*.h5' -exec ./restore.sh {} \;
+  miria find archive@project:/dir -- -type f -execdir sh -c 'echo "$MIRIA_PARENT: $*"' sh {} +`,
+	Args: resumableArgs(expressionArgs(0, 1)),
 	Run: func(cmd *cobra.Command, args []string) {
-		AuthenticateIfNecessary()
-		findOpt.Opt.Path = args[0]
-		cout := make(chan []client.SearchResult)
-		cerr := make(chan error)
-		rootDepth := depth(findOpt.Opt.Path)
-		go miria.Find(findOpt.Opt, cout, cerr)
-	out:
-		for {
-			select {
-			case err := <-cerr:
-				log.ErrorCheck(err, "")
-				return
-			case buf := <-cout:
-				if buf == nil {
-					break out
-				} else {
-					for _, r := range buf {
-						if findOpt.MaxDepth < 0 || depth(r.ObjectPath)-rootDepth <= findOpt.MaxDepth {
-							if findOpt.List {
-								if findOpt.Humanize {
-									log.Msg.Printf("%6s %6s %20s %s", r.ObjectType,
-										log.SizeString((log.ByteSize)(r.ObjectSize)), r.InstanceBackupDate, r.ObjectPath)
-								} else {
-									log.Msg.Printf("%6s %12d %20s %s", r.ObjectType, r.ObjectSize,
-										r.InstanceBackupDate, r.ObjectPath)
-								}
-							} else {
-								log.Msg.Println(r.ObjectPath)
-							}
-						}
+		args, err := findOpt.Checkpoint.init(cmd, args)
+		log.ErrorCheck(err, "")
+		var actions []*execAction
+		args, findOpt.Opt.Expr, actions, err = parseExpressionArgs(cmd, args)
+		log.ErrorCheck(err, "")
+		p := ""
+		switch {
+		case len(args) > 0:
+			p = args[0]
+		case !findOpt.Scan.Index:
+			log.Err.Fatalln("a path is required, unless searching all local indexes with --index")
+		}
+		err = findOpt.Scan.apply(&findOpt.Opt, p)
+		log.ErrorCheck(err, "")
+		if findOpt.Output.needsRepositories() {
+			// IDs are shown if the names are unavailable
+			findOpt.Output.Repositories, err = searchRepositoryNames(findOpt.Scan.Index)()
+			if err != nil {
+				log.Dbg.Printf("cannot get repository names: %s", err.Error())
+			}
+		}
+		findOpt.Checkpoint.printed = !findOpt.Output.Count
+		if len(actions) > 0 {
+			if findOpt.Output.Count || findOpt.Output.Summary {
+				log.Err.Fatalln("--count and --summary cannot be used with -exec actions")
+			}
+			runner := newExecRunner(findOpt.Jobs)
+			_, err = runScan(findOpt.Opt, &findOpt.Checkpoint, func(results []client.SearchResult) error {
+				for _, r := range results {
+					for _, a := range actions {
+						a.add(r, runner)
+					}
+				}
+				if findOpt.Checkpoint.enabled() {
+					// pending batches are not saved in the checkpoint
+					for _, a := range actions {
+						a.flush(runner)
 					}
 				}
+				return nil
+			})
+			if err == nil {
+				for _, a := range actions {
+					a.flush(runner)
+				}
+			}
+			status := runner.wait()
+			log.ErrorCheck(err, "")
+			if status != 0 {
+				os.Exit(status)
+			}
+			return
+		}
+		if findOpt.Output.Count {
+			state, err := runScan(findOpt.Opt, &findOpt.Checkpoint, func([]client.SearchResult) error {
+				return nil
+			})
+			log.ErrorCheck(err, "")
+			err = writeCount(os.Stdout, state, findOpt.Output.Humanize)
+			log.ErrorCheck(err, "")
+			return
+		}
+		findOpt.Output.Continued = findOpt.Checkpoint.state.Offset > 0
+		out, err := newResultWriter(findOpt.Output, findOpt.Opt.Path, os.Stdout)
+		log.ErrorCheck(err, "")
+		state, err := runScan(findOpt.Opt, &findOpt.Checkpoint, func(results []client.SearchResult) error {
+			for _, r := range results {
+				err := out.Write(r)
+				if err != nil {
+					return err
+				}
+			}
+			return out.Flush()
+		})
+		if err != nil && !findOpt.Checkpoint.enabled() {
+			// terminate structured outputs, unless they are continued by --resume
+			out.Close()
+		}
+		log.ErrorCheck(err, "")
+		err = out.Close()
+		log.ErrorCheck(err, "")
+		if findOpt.Output.Summary {
+			// keep structured outputs valid
+			w := os.Stderr
+			if findOpt.Output.Printf == "" && !findOpt.Output.Print0 &&
+				(findOpt.Output.Format == "" || findOpt.Output.Format == "text") {
+				w = os.Stdout
 			}
+			err = writeSummary(w, state, findOpt.Output.Humanize)
+			log.ErrorCheck(err, "")
 		}
 	},
 }
 
 var findOpt = struct {
-	Opt      client.FindOptions
-	List     bool
-	Humanize bool
-	MaxDepth int
-}{client.FindOptions{Path: "", Type: "", Pattern: ""}, false, false, -1}
+	Opt        client.FindOptions
+	Output     outputOptions
+	Scan       scanFlags
+	Checkpoint checkpointFlags
+	Jobs       int
+}{client.FindOptions{Path: "", Type: "", Pattern: "", MaxDepth: -1}, outputOptions{Format: "text"},
+	scanFlags{}, checkpointFlags{}, 1}
 
 func init() {
 	rootCmd.AddCommand(findCmd)
 	findCmd.Flags().StringVarP(&findOpt.Opt.Pattern, "name", "n", "", "search pattern")
 	findCmd.Flags().StringVarP(&findOpt.Opt.Type, "type", "t", "",
 		"filter file type (d or f)")
-	findCmd.Flags().BoolVarP(&findOpt.Humanize, "human-readable", "H", false,
+	findCmd.Flags().BoolVarP(&findOpt.Output.Humanize, "human-readable", "H", false,
 		"human-readable sizes")
 	findCmd.Flags().Lookup("human-readable").NoOptDefVal = "true"
-	findCmd.Flags().BoolVarP(&findOpt.List, "list", "l", false,
+	findCmd.Flags().BoolVarP(&findOpt.Output.List, "list", "l", false,
 		"columns with file type and size")
 	findCmd.Flags().Lookup("list").NoOptDefVal = "true"
-	findCmd.Flags().IntVarP(&findOpt.MaxDepth, "max-depth", "d", -1, "maximum depth (-1 is unlimited)")
+	findCmd.Flags().StringVarP(&findOpt.Output.Format, "format", "f", "text",
+		"output format (text, json, ndjson, csv or tsv)")
+	findCmd.Flags().StringVar(&findOpt.Output.Printf, "printf", "",
+		"print results using a template, see the command help for directives")
+	findCmd.Flags().BoolVar(&findOpt.Output.Print0, "print0", false,
+		"print paths separated by NUL characters (for xargs -0)")
+	findCmd.Flags().BoolVarP(&findOpt.Output.Count, "count", "c", false,
+		"only print the number of results and their total size")
+	findCmd.Flags().BoolVar(&findOpt.Output.Summary, "summary", false,
+		"print file and directory counts, total size and backup date range at the end")
+	findCmd.Flags().IntVarP(&findOpt.Opt.MaxDepth, "max-depth", "d", -1, "maximum depth (-1 is unlimited)")
+	findCmd.Flags().IntVar(&findOpt.Opt.MinDepth, "min-depth", 0, "minimum depth")
+	findCmd.Flags().StringVar(&findOpt.Opt.Versions, "versions", "",
+		"instances to show for each object (all, latest or first, default all)")
+	findCmd.Flags().IntVar(&findOpt.Opt.Limit, "limit", 0, "stop after this number of results (0 is unlimited)")
+	findCmd.Flags().IntVarP(&findOpt.Jobs, "jobs", "j", 1, "number of -exec commands run in parallel")
+	addScanFlags(findCmd, &findOpt.Scan, "search the local index (see 'miria index')")
+	addCheckpointFlags(findCmd, &findOpt.Checkpoint)
 }
 
-func depth(path string) int {
-	var depth int = 0
-	colSplit := strings.Split(path, ":")
-	slashSplit := strings.Split(colSplit[1], "/")
-	for _, name := range slashSplit {
-		if name != "" {
-			depth++
+// Between min and max positional arguments, followed by an optional
+// expression after `--`
+func expressionArgs(min int, max int) cobra.PositionalArgs {
+	return func(cmd *cobra.Command, args []string) error {
+		if dash := cmd.ArgsLenAtDash(); dash >= 0 {
+			return cobra.RangeArgs(min, max)(cmd, args[:dash])
 		}
+		return cobra.RangeArgs(min, max)(cmd, args)
+	}
+}
+
+// Split positional arguments, expression and actions
+func parseExpressionArgs(cmd *cobra.Command, args []string) ([]string, client.Expr, []*execAction, error) {
+	dash := cmd.ArgsLenAtDash()
+	if dash < 0 {
+		return args, nil, nil, nil
 	}
-	if depth == 0 {
-		return depth
-	} else {
-		return depth - 1
+	tokens, actions, err := parseExecActions(args[dash:])
+	if err != nil {
+		return nil, nil, nil, err
 	}
+	expr, err := client.ParseExpression(tokens)
+	return args[:dash], expr, actions, err
 }
@@ -0,0 +1,286 @@
+/*
+Copyright © 2022 Antonin Portelli <antonin.portelli@me.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+
+	log "github.com/aportelli/golog"
+	"github.com/aportelli/miria-cli/client"
+)
+
+// Output of search results, Flush is called after each page
+type resultWriter interface {
+	Write(r client.SearchResult) error
+	Flush() error
+	Close() error
+}
+
+type outputOptions struct {
+	Format       string
+	Printf       string
+	List         bool
+	Humanize     bool
+	Print0       bool
+	Count        bool
+	Summary      bool
+	Repositories map[int]string // repository names, if needed by the output
+	Continued    bool           // continue the output of an interrupted scan
+}
+
+// Whether the output shows repository names
+func (opt outputOptions) needsRepositories() bool {
+	if opt.Printf != "" {
+		return printfRepository.MatchString(opt.Printf)
+	}
+	return !opt.Count && (opt.Format != "" && opt.Format != "text" || opt.List && !opt.Print0)
+}
+
+// Size in bytes, or human-readable
+func sizeString(size uint64, humanize bool) string {
+	if humanize {
+		return log.SizeString(log.ByteSize(size))
+	}
+	return strconv.FormatUint(size, 10)
+}
+
+// Number of results and total size
+func writeCount(w io.Writer, state checkpoint, humanize bool) error {
+	_, err := fmt.Fprintf(w, "%d %s\n", state.Offset, sizeString(state.Bytes, humanize))
+	return err
+}
+
+// Summary footer of the results
+func writeSummary(w io.Writer, state checkpoint, humanize bool) error {
+	dates := "none"
+	if !state.Earliest.IsZero() {
+		dates = state.Earliest.Format(client.BackupDateLayout) + " to " +
+			state.Latest.Format(client.BackupDateLayout)
+	}
+	_, err := fmt.Fprintf(w, "Files:        %d\nDirectories:  %d\nTotal size:   %s\nBackup dates: %s\n",
+		state.Offset-state.Dirs, state.Dirs, sizeString(state.Bytes, humanize), dates)
+	return err
+}
+
+var resultFormats = []string{"text", "json", "ndjson", "csv", "tsv"}
+
+// Writer for the given output options, root is the search root path. A
+// continued JSON output has no opening bracket, and a continued CSV output no
+// header, so that it can be concatenated to the output of the interrupted scan.
+func newResultWriter(opt outputOptions, root string, w io.Writer) (resultWriter, error) {
+	if opt.Printf != "" {
+		tmpl, err := compilePrintf(opt.Printf, opt.Repositories)
+		if err != nil {
+			return nil, err
+		}
+		return &printfWriter{w: bufio.NewWriter(w), tmpl: tmpl, root: root}, nil
+	}
+	switch opt.Format {
+	case "", "text":
+		if opt.Print0 {
+			return &print0Writer{w: bufio.NewWriter(w)}, nil
+		}
+		return &textWriter{list: opt.List, humanize: opt.Humanize, names: opt.Repositories}, nil
+	case "json":
+		return &jsonWriter{w: bufio.NewWriter(w), first: !opt.Continued, names: opt.Repositories}, nil
+	case "ndjson":
+		return &ndjsonWriter{w: bufio.NewWriter(w), names: opt.Repositories}, nil
+	case "csv", "tsv":
+		cw := csv.NewWriter(w)
+		if opt.Format == "tsv" {
+			cw.Comma = '\t'
+		}
+		return &csvWriter{w: cw, header: !opt.Continued, names: opt.Repositories}, nil
+	default:
+		return nil, fmt.Errorf("unknown format '%s' (possible values: %v)", opt.Format, resultFormats)
+	}
+}
+
+// Plain text, one path per line or columns ///////////////////////////////////
+type textWriter struct {
+	list     bool
+	humanize bool
+	names    map[int]string
+}
+
+func (t *textWriter) Write(r client.SearchResult) error {
+	if t.list {
+		repo := repositoryName(t.names, r.RepositoryId)
+		if t.humanize {
+			log.Msg.Printf("%6s %6s %20s %8s %s", r.ObjectType,
+				log.SizeString((log.ByteSize)(r.ObjectSize)), r.InstanceBackupDate, repo, r.ObjectPath)
+		} else {
+			log.Msg.Printf("%6s %12d %20s %8s %s", r.ObjectType, r.ObjectSize,
+				r.InstanceBackupDate, repo, r.ObjectPath)
+		}
+	} else {
+		log.Msg.Println(r.ObjectPath)
+	}
+	return nil
+}
+
+func (t *textWriter) Flush() error { return nil }
+func (t *textWriter) Close() error { return nil }
+
+// Paths terminated by NUL characters ////////////////////////////////////////
+type print0Writer struct {
+	w *bufio.Writer
+}
+
+func (p *print0Writer) Write(r client.SearchResult) error {
+	p.w.WriteString(r.ObjectPath)
+	return p.w.WriteByte(0)
+}
+
+func (p *print0Writer) Flush() error {
+	return p.w.Flush()
+}
+
+func (p *print0Writer) Close() error {
+	return p.w.Flush()
+}
+
+// User template //////////////////////////////////////////////////////////////
+type printfWriter struct {
+	w    *bufio.Writer
+	tmpl printfTemplate
+	root string
+}
+
+func (p *printfWriter) Write(r client.SearchResult) error {
+	_, err := p.w.WriteString(p.tmpl.format(p.root, r))
+	return err
+}
+
+func (p *printfWriter) Flush() error {
+	return p.w.Flush()
+}
+
+func (p *printfWriter) Close() error {
+	return p.w.Flush()
+}
+
+// Search result with the repository name, for structured outputs
+type namedResult struct {
+	client.SearchResult
+	RepositoryName string `json:"repositoryName"`
+}
+
+// JSON array, streamed element by element ////////////////////////////////////
+type jsonWriter struct {
+	w     *bufio.Writer
+	first bool
+	names map[int]string
+}
+
+func (j *jsonWriter) Write(r client.SearchResult) error {
+	buf, err := json.Marshal(namedResult{r, repositoryName(j.names, r.RepositoryId)})
+	if err != nil {
+		return err
+	}
+	if j.first {
+		j.w.WriteString("[\n  ")
+		j.first = false
+	} else {
+		j.w.WriteString(",\n  ")
+	}
+	_, err = j.w.Write(buf)
+	return err
+}
+
+func (j *jsonWriter) Flush() error {
+	return j.w.Flush()
+}
+
+func (j *jsonWriter) Close() error {
+	if j.first {
+		j.w.WriteString("[")
+	}
+	j.w.WriteString("\n]\n")
+	return j.w.Flush()
+}
+
+// Newline-delimited JSON /////////////////////////////////////////////////////
+type ndjsonWriter struct {
+	w     *bufio.Writer
+	names map[int]string
+}
+
+func (n *ndjsonWriter) Write(r client.SearchResult) error {
+	buf, err := json.Marshal(namedResult{r, repositoryName(n.names, r.RepositoryId)})
+	if err != nil {
+		return err
+	}
+	n.w.Write(buf)
+	return n.w.WriteByte('\n')
+}
+
+func (n *ndjsonWriter) Flush() error {
+	return n.w.Flush()
+}
+
+func (n *ndjsonWriter) Close() error {
+	return n.w.Flush()
+}
+
+// CSV or TSV with header /////////////////////////////////////////////////////
+type csvWriter struct {
+	w      *csv.Writer
+	header bool
+	names  map[int]string
+}
+
+var csvHeader = []string{"instanceBackupDate", "instanceId", "objectId", "objectName",
+	"objectPath", "objectSize", "objectType", "repositoryId", "repositoryName"}
+
+func (c *csvWriter) Write(r client.SearchResult) error {
+	if c.header {
+		c.header = false
+		if err := c.w.Write(csvHeader); err != nil {
+			return err
+		}
+	}
+	return c.w.Write([]string{
+		r.InstanceBackupDate,
+		strconv.Itoa(r.InstanceId),
+		strconv.Itoa(r.ObjectId),
+		r.ObjectName,
+		r.ObjectPath,
+		strconv.FormatUint(r.ObjectSize, 10),
+		r.ObjectType,
+		strconv.Itoa(r.RepositoryId),
+		repositoryName(c.names, r.RepositoryId),
+	})
+}
+
+func (c *csvWriter) Flush() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+func (c *csvWriter) Close() error {
+	if c.header {
+		c.header = false
+		c.w.Write(csvHeader)
+	}
+	return c.Flush()
+}
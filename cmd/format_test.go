@@ -0,0 +1,77 @@
+/*
+Copyright © 2022 Antonin Portelli <antonin.portelli@me.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/aportelli/miria-cli/client"
+)
+
+// Output of a scan interrupted after first results, followed by the output of
+// the resumed scan with the rest
+func testResumedOutput(t *testing.T, format string, first int, results []client.SearchResult) string {
+	var buf bytes.Buffer
+
+	out, err := newResultWriter(outputOptions{Format: format}, "archive@p:/", &buf)
+	if err != nil {
+		t.Fatalf("newResultWriter(%q): %s", format, err)
+	}
+	for _, r := range results[:first] {
+		out.Write(r)
+	}
+	out.Flush()
+	out, _ = newResultWriter(outputOptions{Format: format, Continued: first > 0}, "archive@p:/", &buf)
+	for _, r := range results[first:] {
+		out.Write(r)
+	}
+	out.Close()
+	return buf.String()
+}
+
+func TestResumedOutput(t *testing.T) {
+	results := []client.SearchResult{
+		{ObjectPath: "archive@p:/a", ObjectName: "a"},
+		{ObjectPath: "archive@p:/b", ObjectName: "b"},
+		{ObjectPath: "archive@p:/c", ObjectName: "c"},
+	}
+	for first := 0; first <= len(results); first++ {
+		var decoded []map[string]any
+
+		out := testResumedOutput(t, "json", first, results)
+		if err := json.Unmarshal([]byte(out), &decoded); err != nil || len(decoded) != len(results) {
+			t.Errorf("json resumed after %d results: got %d results, error %v in\n%s", first, len(decoded),
+				err, out)
+		}
+		for _, format := range []string{"csv", "tsv"} {
+			out = testResumedOutput(t, format, first, results)
+			r := csv.NewReader(strings.NewReader(out))
+			if format == "tsv" {
+				r.Comma = '\t'
+			}
+			rows, err := r.ReadAll()
+			if err != nil || len(rows) != len(results)+1 || rows[0][0] != csvHeader[0] {
+				t.Errorf("%s resumed after %d results: got %d rows, error %v in\n%s", format, first, len(rows),
+					err, out)
+			}
+		}
+	}
+}
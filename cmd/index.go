@@ -0,0 +1,149 @@
+/*
+Copyright © 2022 Antonin Portelli <antonin.portelli@me.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"context"
+	"os"
+	"os/signal"
+
+	log "github.com/aportelli/golog"
+	"github.com/aportelli/miria-cli/client"
+	"github.com/spf13/cobra"
+)
+
+var indexCmd = &cobra.Command{
+	Use:   "index",
+	Short: "Manage local indexes of archive listings",
+	Long: `Manage local indexes of archive listings. An index stores all the instances
+under a path of the configured host in the cache directory, ` + "`find`" + ` and ` + "`du`" + `
+can then answer queries on this path or its subdirectories without contacting
+the server using --index, and ` + "`find --index`" + ` without a path searches all the
+indexes of the host.
+
+Indexes are stored in a SQLite database per host, where instances are looked
+up by path, parent directory and name, so that a query only reads the
+instances under the searched path, or with the searched name when it is given
+without brackets or escapes. Building an index of a path replaces the indexes
+below it, and building one below an indexed path updates this part of the
+index.`,
+}
+
+var indexBuildCmd = &cobra.Command{
+	Use:   "build <path>",
+	Short: "Build index of a path",
+	Long: `Scan all the instances under a path and save them in a local index,
+replacing the previous indexes of the same path or below it.
+
+Example:
+  miria index build archive@project:/dir --split`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		AuthenticateIfNecessary()
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		opt := client.FindOptions{Path: args[0]}
+		indexOpt.Fetch.apply(&opt)
+		idx, err := miria.BuildIndex(ctx, opt)
+		log.ErrorCheck(err, "")
+		defer idx.Close()
+		log.Msg.Printf("%d instances indexed under %s", idx.Count, idx.Root)
+	},
+}
+
+var indexRefreshCmd = &cobra.Command{
+	Use:   "refresh [path]",
+	Short: "Update indexes with new instances",
+	Long: `Add the instances backed up since the last refresh to the index containing
+a path, or to all indexes if no path is given. Instances deleted from the
+archive are only removed by building the index again.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		var roots []string
+
+		if len(args) > 0 {
+			roots = append(roots, args[0])
+		} else {
+			headers, err := miria.ListIndexes()
+			log.ErrorCheck(err, "")
+			for _, h := range headers {
+				roots = append(roots, h.Root)
+			}
+		}
+		AuthenticateIfNecessary()
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		for _, root := range roots {
+			idx, err := miria.LoadIndex(root)
+			log.ErrorCheck(err, "")
+			var opt client.FindOptions
+			indexOpt.Fetch.apply(&opt)
+			added, err := miria.RefreshIndex(ctx, idx, opt)
+			idx.Close()
+			log.ErrorCheck(err, "")
+			log.Msg.Printf("%d new instances indexed under %s", added, idx.Root)
+		}
+	},
+}
+
+var indexListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List indexes",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		headers, err := miria.ListIndexes()
+		log.ErrorCheck(err, "")
+		for _, h := range headers {
+			log.Msg.Printf("%10d %s %s", h.Count, h.Refreshed.Format("2006-01-02 15:04:05"), h.Root)
+		}
+	},
+}
+
+// Search the local index containing opt.Path, or all the local indexes if it
+// is empty, if useIndex is set, otherwise authenticate to search the server
+func selectIndex(opt *client.FindOptions, useIndex bool) error {
+	if !useIndex {
+		AuthenticateIfNecessary()
+		return nil
+	}
+	idx, err := miria.LoadIndex(opt.Path)
+	if err != nil {
+		return err
+	}
+	if idx.Root == "" {
+		log.Inf.Printf("Using all indexes of %s, refreshed on %s at the earliest", idx.Host,
+			idx.Refreshed.Format("2006-01-02 15:04:05"))
+	} else {
+		log.Inf.Printf("Using index of %s refreshed on %s", idx.Root, idx.Refreshed.Format("2006-01-02 15:04:05"))
+	}
+	opt.Index = idx
+	return nil
+}
+
+var indexOpt = struct {
+	Fetch fetchFlags
+}{fetchFlags{}}
+
+func init() {
+	rootCmd.AddCommand(indexCmd)
+	indexCmd.AddCommand(indexBuildCmd)
+	indexCmd.AddCommand(indexRefreshCmd)
+	indexCmd.AddCommand(indexListCmd)
+	for _, c := range []*cobra.Command{indexBuildCmd, indexRefreshCmd} {
+		addFetchFlags(c, &indexOpt.Fetch)
+	}
+}
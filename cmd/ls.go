@@ -0,0 +1,302 @@
+/*
+Copyright © 2022 Antonin Portelli <antonin.portelli@me.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	log "github.com/aportelli/golog"
+	"github.com/aportelli/miria-cli/client"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// lsCmd represents the ls command
+var lsCmd = &cobra.Command{
+	Use:   "ls <path>...",
+	Short: "List the contents of archive directories",
+	Long: `List the immediate contents of archive directories, mimicking the ` + "`ls`" + ` Unix
+command. Only one level below each path is requested from the server using depth
+criteria, which is much faster than ` + "`find`" + ` on large trees. If the server does
+not support depth criteria, the whole tree below the path is scanned and
+filtered client-side, which is as slow as ` + "`find`" + `. Directories are marked with a
+trailing '/'.
+
+A glob in the last component of a path lists the matching entries of its parent
+directory. Names starting with '.' are hidden unless -a is given or the glob
+starts with '.'. By default, only the latest instance of each object is shown.
+
+Entries are sorted by name, by backup date with -t, or by size with -S, the
+newest or largest first. With -l, the type, size, backup date and repository
+of each entry are shown.
+
+Example:
+  miria ls archive@project:/dir
+  miria ls -lH archive@project:/dir
+  miria ls -lt 'archive@project:/dir/*.nc'
+  miria ls archive@project:/dir1 archive@project:/dir2`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if lsOpt.Time && lsOpt.Size {
+			log.Err.Fatalln("-t and -S cannot be used together")
+		}
+		if !lsOpt.Index {
+			AuthenticateIfNecessary()
+		}
+		var names map[int]string
+		if lsOpt.Long {
+			var err error
+			names, err = searchRepositoryNames(lsOpt.Index)()
+			if err != nil {
+				log.Dbg.Printf("cannot get repository names: %s", err.Error())
+			}
+		}
+		failed := false
+		first := true
+		for _, p := range args {
+			entries, err := lsEntries(p)
+			if err != nil {
+				log.Err.Printf("cannot access '%s': %s", p, err.Error())
+				failed = true
+				continue
+			}
+			if len(args) > 1 {
+				if !first {
+					log.Msg.Println()
+				}
+				log.Msg.Printf("%s:", p)
+			}
+			first = false
+			lsSort(entries)
+			if lsOpt.Long {
+				lsLong(entries, names)
+			} else {
+				lsColumns(entries)
+			}
+		}
+		if failed {
+			os.Exit(1)
+		}
+	},
+}
+
+var lsOpt = struct {
+	Versions string
+	Long     bool
+	Humanize bool
+	All      bool
+	Time     bool
+	Size     bool
+	Reverse  bool
+	Index    bool
+}{client.VersionsLatest, false, false, false, false, false, false, false}
+
+func init() {
+	rootCmd.AddCommand(lsCmd)
+	lsCmd.Flags().BoolVarP(&lsOpt.Long, "long", "l", false, "long listing")
+	lsCmd.Flags().BoolVarP(&lsOpt.Humanize, "human-readable", "H", false,
+		"human-readable sizes")
+	lsCmd.Flags().BoolVarP(&lsOpt.All, "all", "a", false, "show names starting with '.'")
+	lsCmd.Flags().BoolVarP(&lsOpt.Time, "time", "t", false, "sort by backup date, newest first")
+	lsCmd.Flags().BoolVarP(&lsOpt.Size, "size", "S", false, "sort by size, largest first")
+	lsCmd.Flags().BoolVarP(&lsOpt.Reverse, "reverse", "r", false, "reverse the sort order")
+	lsCmd.Flags().StringVar(&lsOpt.Versions, "versions", client.VersionsLatest,
+		"instances to show for each object (all, latest or first)")
+	lsCmd.Flags().BoolVar(&lsOpt.Index, "index", false, "list from the local index (see 'miria index')")
+}
+
+// All results of a search
+func collectResults(opt client.FindOptions) ([]client.SearchResult, error) {
+	var results []client.SearchResult
+
+	it := miria.Find(context.Background(), opt)
+	defer it.Close()
+	for it.Next() {
+		results = append(results, it.Result())
+	}
+	return results, it.Err()
+}
+
+// Depth-one search below dir, for names matching pattern
+func lsSearch(dir string, pattern string, idx *client.Index) ([]client.SearchResult, error) {
+	opt := client.FindOptions{Path: dir, Pattern: pattern, MinDepth: 1, MaxDepth: 1,
+		Versions: lsOpt.Versions, Index: idx}
+	return collectResults(opt)
+}
+
+// Entries listed for a path argument
+func lsEntries(p string) ([]client.SearchResult, error) {
+	var idx *client.Index
+
+	p = client.CleanObjectPath(p)
+	_, rest := client.SplitObjectPath(p)
+	base := path.Base(rest)
+	isGlob := strings.ContainsAny(base, "*?[")
+	if lsOpt.Index {
+		var err error
+		idx, err = miria.LoadIndex(p)
+		if err != nil {
+			return nil, err
+		}
+	}
+	// the path itself, or the entries matching the glob, are searched in the
+	// parent directory, which is above the root of an index built for p
+	if isGlob || rest != "/" && (idx == nil || idx.Root != p) {
+		pattern := base
+		if !isGlob {
+			pattern = strings.ReplaceAll(base, "\\", "\\\\")
+		}
+		parent, err := lsSearch(client.ParentPath(p), pattern, idx)
+		if err != nil {
+			return nil, err
+		}
+		if isGlob {
+			if len(parent) == 0 {
+				return nil, fmt.Errorf("no match")
+			}
+			return lsVisible(parent, strings.HasPrefix(base, ".")), nil
+		}
+		if len(parent) == 0 {
+			return nil, fmt.Errorf("no such file or directory")
+		}
+		if !parent[0].IsDir() {
+			return parent, nil
+		}
+	}
+	entries, err := lsSearch(p, "*", idx)
+	if err != nil {
+		return nil, err
+	}
+	return lsVisible(entries, false), nil
+}
+
+// Entries without hidden names, unless -a is given or all is true
+func lsVisible(entries []client.SearchResult, all bool) []client.SearchResult {
+	if lsOpt.All || all {
+		return entries
+	}
+	visible := entries[:0]
+	for _, r := range entries {
+		if !strings.HasPrefix(r.ObjectName, ".") {
+			visible = append(visible, r)
+		}
+	}
+	return visible
+}
+
+func lsSort(entries []client.SearchResult) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if lsOpt.Reverse {
+			a, b = b, a
+		}
+		switch {
+		case lsOpt.Time && a.InstanceBackupDate != b.InstanceBackupDate:
+			return a.BackupTime().After(b.BackupTime())
+		case lsOpt.Size && a.ObjectSize != b.ObjectSize:
+			return a.ObjectSize > b.ObjectSize
+		}
+		return a.ObjectName < b.ObjectName
+	})
+}
+
+// Name as displayed, directories end with '/'
+func lsName(r client.SearchResult) string {
+	if r.IsDir() {
+		return r.ObjectName + "/"
+	}
+	return r.ObjectName
+}
+
+func lsLong(entries []client.SearchResult, names map[int]string) {
+	for _, r := range entries {
+		t := "-"
+		if r.IsDir() {
+			t = "d"
+		}
+		date := "-"
+		if bt := r.BackupTime(); !bt.IsZero() {
+			date = bt.Format(client.BackupDateLayout)
+		}
+		log.Msg.Printf("%s %12s %19s %8s %s", t, sizeString(r.ObjectSize, lsOpt.Humanize), date,
+			repositoryName(names, r.RepositoryId), lsName(r))
+	}
+}
+
+// Names in columns filling the terminal width, with control characters
+// replaced, or one per line if the output is not a terminal
+func lsColumns(entries []client.SearchResult) {
+	width, _, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil {
+		for _, r := range entries {
+			log.Msg.Println(lsName(r))
+		}
+		return
+	}
+	n := len(entries)
+	lengths := make([]int, n)
+	for i, e := range entries {
+		lengths[i] = len([]rune(printable(lsName(e))))
+	}
+	// a column is at least 3 characters wide with the separator
+	maxCols := width / 3
+	if maxCols < 1 {
+		maxCols = 1
+	}
+	if maxCols > n {
+		maxCols = n
+	}
+	cols, rows := 1, n
+	var widths []int
+	for c := maxCols; c >= 1; c-- {
+		r := (n + c - 1) / c
+		w := make([]int, (n+r-1)/r)
+		total := 0
+		for i, l := range lengths {
+			if l+2 > w[i/r] {
+				w[i/r] = l + 2
+			}
+		}
+		for _, l := range w {
+			total += l
+		}
+		if total-2 <= width || c == 1 {
+			cols, rows, widths = len(w), r, w
+			break
+		}
+	}
+	for row := 0; row < rows; row++ {
+		var line strings.Builder
+		for col := 0; col < cols; col++ {
+			i := col*rows + row
+			if i >= n {
+				break
+			}
+			name := printable(lsName(entries[i]))
+			line.WriteString(name)
+			if col < cols-1 && (col+1)*rows+row < n {
+				line.WriteString(strings.Repeat(" ", widths[col]-len([]rune(name))))
+			}
+		}
+		log.Msg.Println(line.String())
+	}
+}
@@ -0,0 +1,220 @@
+/*
+Copyright © 2022 Antonin Portelli <antonin.portelli@me.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	log "github.com/aportelli/golog"
+	"github.com/aportelli/miria-cli/client"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// ncduCmd represents the ncdu command
+var ncduCmd = &cobra.Command{
+	Use:   "ncdu <path>",
+	Short: "Browse the archive usage of the given path interactively",
+	Long: `Scan a given path once and browse the size of its directories in the terminal,
+mimicking the ` + "`ncdu`" + ` Unix command. By default, only the latest instance of each
+file is counted.
+
+The scanned tree can be saved to a JSON file with --export, in which case no
+browser is started, and browsed later with --import without scanning again.
+
+Keys:
+  up/down, k/j     move the selection
+  pgup/pgdn        move the selection by one page
+  enter, right, l  open the selected directory
+  left, h, bksp    go to the parent directory
+  s, c, n          sort by size, number of files or name
+  q                quit
+
+Example:
+  miria ncdu archive@project:/dir
+  miria ncdu archive@project:/dir --versions all --export dir.json
+  miria ncdu --import dir.json`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if cmd.Flags().Changed("import") {
+			return cobra.NoArgs(cmd, args)
+		}
+		return cobra.ExactArgs(1)(cmd, args)
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		var tree ncduTree
+		var err error
+
+		if ncduOpt.Import != "" {
+			tree, err = readNcduTree(ncduOpt.Import)
+			log.ErrorCheck(err, "")
+		} else {
+			if ncduOpt.Export == "" && !ncduTerminal() {
+				log.Err.Fatalln("the browser needs a terminal, use --export to save the tree instead")
+			}
+			err = ncduOpt.Scan.apply(&ncduOpt.Opt, args[0])
+			log.ErrorCheck(err, "")
+			tree, err = scanNcduTree(ncduOpt.Opt)
+			log.ErrorCheck(err, "")
+		}
+		if ncduOpt.Export != "" {
+			err = tree.write(ncduOpt.Export)
+			log.ErrorCheck(err, "")
+			return
+		}
+		if !ncduTerminal() {
+			log.Err.Fatalln("the browser needs a terminal")
+		}
+		err = browse(tree)
+		log.ErrorCheck(err, "")
+	},
+}
+
+var ncduOpt = struct {
+	Opt    client.FindOptions
+	Export string
+	Import string
+	Scan   scanFlags
+}{client.FindOptions{Path: "", Type: "", Pattern: "*", MaxDepth: -1,
+	Versions: client.VersionsLatest}, "", "", scanFlags{}}
+
+func init() {
+	rootCmd.AddCommand(ncduCmd)
+	ncduCmd.Flags().StringVarP(&ncduOpt.Export, "export", "o", "", "save the scanned tree to a JSON file")
+	ncduCmd.Flags().StringVarP(&ncduOpt.Import, "import", "f", "",
+		"browse a tree saved with --export instead of scanning")
+	ncduCmd.Flags().StringVar(&ncduOpt.Opt.Versions, "versions", client.VersionsLatest,
+		"instances to count for each file (all, latest or first)")
+	addScanFlags(ncduCmd, &ncduOpt.Scan, "scan the local index (see 'miria index')")
+}
+
+// Whether the browser can run
+func ncduTerminal() bool {
+	return term.IsTerminal(int(os.Stdin.Fd())) && term.IsTerminal(int(os.Stdout.Fd()))
+}
+
+// Size tree //////////////////////////////////////////////////////////////////
+type ncduNode struct {
+	Name     string      `json:"name"`
+	Dir      bool        `json:"dir,omitempty"`
+	Size     uint64      `json:"size"`
+	Count    uint64      `json:"count"` // number of file instances below
+	Children []*ncduNode `json:"children,omitempty"`
+	parent   *ncduNode
+	index    map[string]*ncduNode // children by name
+}
+
+// Tree as saved by --export
+type ncduTree struct {
+	Root    string    `json:"root"`
+	Scanned time.Time `json:"scanned"`
+	Tree    *ncduNode `json:"tree"`
+}
+
+// Child with the given name, created if needed
+func (n *ncduNode) child(name string, dir bool) *ncduNode {
+	if c, ok := n.index[name]; ok {
+		c.Dir = c.Dir || dir
+		return c
+	}
+	if n.index == nil {
+		n.index = make(map[string]*ncduNode)
+	}
+	c := &ncduNode{Name: name, Dir: dir, parent: n}
+	n.index[name] = c
+	n.Children = append(n.Children, c)
+	return c
+}
+
+// Add a result below the root, and its size to all its ancestors
+func (n *ncduNode) add(root string, r client.SearchResult) {
+	p := client.CleanObjectPath(r.ObjectPath)
+	if p == root || !client.UnderPath(p, root) {
+		return
+	}
+	names := strings.Split(strings.TrimPrefix(p, strings.TrimSuffix(root, "/")+"/"), "/")
+	node := n
+	for i, name := range names {
+		node = node.child(name, i < len(names)-1 || r.IsDir())
+	}
+	if r.IsDir() {
+		return
+	}
+	for ; node != nil; node = node.parent {
+		node.Size += r.ObjectSize
+		node.Count++
+	}
+}
+
+// Restore the parent links after loading
+func (n *ncduNode) link() {
+	for _, c := range n.Children {
+		c.parent = n
+		c.link()
+	}
+}
+
+// Scan the path, showing progress on stderr. With a version selection, the
+// selected files are only known at the end, so the progress is the number of
+// instances scanned.
+func scanNcduTree(opt client.FindOptions) (ncduTree, error) {
+	var ck checkpointFlags
+
+	root := client.CleanObjectPath(opt.Path)
+	tree := ncduTree{Root: root, Scanned: time.Now(), Tree: &ncduNode{Name: root, Dir: true}}
+	progress := term.IsTerminal(int(os.Stderr.Fd()))
+	_, err := runScan(opt, &ck, func(results []client.SearchResult) error {
+		for _, r := range results {
+			tree.Tree.add(root, r)
+		}
+		if progress {
+			fmt.Fprintf(os.Stderr, "\rScanning %s: %d instances, %d files, %s\x1b[K", root, ck.state.Count,
+				tree.Tree.Count, log.SizeString(log.ByteSize(tree.Tree.Size)))
+		}
+		return nil
+	})
+	if progress {
+		fmt.Fprint(os.Stderr, "\r\x1b[K")
+	}
+	return tree, err
+}
+
+func readNcduTree(file string) (ncduTree, error) {
+	var tree ncduTree
+
+	buf, err := os.ReadFile(file)
+	if err != nil {
+		return tree, err
+	}
+	err = json.Unmarshal(buf, &tree)
+	if err != nil || tree.Tree == nil {
+		return tree, fmt.Errorf("invalid tree file '%s'", file)
+	}
+	tree.Tree.link()
+	return tree, nil
+}
+
+func (t ncduTree) write(file string) error {
+	buf, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, buf, 0644)
+}
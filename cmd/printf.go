@@ -0,0 +1,198 @@
+/*
+Copyright © 2022 Antonin Portelli <antonin.portelli@me.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	log "github.com/aportelli/golog"
+	"github.com/aportelli/miria-cli/client"
+)
+
+const printfHelp = `Directives for --printf:
+  %p  path                    %f  name
+  %h  parent directory        %P  path relative to the search root
+  %s  size in bytes           %k  size in kB
+  %z  human-readable size     %y  type (f or d)
+  %Y  server object type      %t  backup date as returned by the server
+  %Tk backup date formatted with k, one of
+      Y (year), m (month), d (day), H (hour), M (minute), S (second),
+      j (day of year), a/A (weekday), b/B (month name), F (%TY-%Tm-%Td),
+      D (%Tm/%Td/yy), T (%TH:%TM:%TS), + (%TF+%TT), s (Unix time) or
+      @ (Unix time, fractional)
+  %i  instance ID             %o  object ID
+  %r  repository ID           %R  repository name
+  %%  literal %
+Flags, width and precision are supported as in printf(3), e.g. %-40p or %12s.
+Escapes: \n, \t, \r, \0, \a, \b, \f, \v and \\.`
+
+// Compiled --printf template, a sequence of literal or field segments
+type printfTemplate []func(root string, r client.SearchResult) string
+
+var strftimeLayouts = map[byte]string{
+	'Y': "2006", 'm': "01", 'd': "02", 'H': "15", 'M': "04", 'S': "05",
+	'a': "Mon", 'A': "Monday", 'b': "Jan", 'B': "January",
+	'F': "2006-01-02", 'T': "15:04:05", '+': "2006-01-02+15:04:05", 'D': "01/02/06",
+}
+
+// Directive showing the repository name, not preceded by an escaped '%'
+var printfRepository = regexp.MustCompile(`(^|[^%])(%%)*%[-+ #0-9.]*R`)
+
+func compilePrintf(format string, repositories map[int]string) (printfTemplate, error) {
+	var tmpl printfTemplate
+	var lit strings.Builder
+
+	flushLiteral := func() {
+		if lit.Len() > 0 {
+			s := lit.String()
+			tmpl = append(tmpl, func(string, client.SearchResult) string { return s })
+			lit.Reset()
+		}
+	}
+	escapes := map[byte]byte{'n': '\n', 't': '\t', 'r': '\r', '0': 0, 'a': '\a', 'b': '\b',
+		'f': '\f', 'v': '\v', '\\': '\\'}
+	for i := 0; i < len(format); i++ {
+		c := format[i]
+		switch {
+		case c == '\\' && i+1 < len(format):
+			i++
+			e, ok := escapes[format[i]]
+			if !ok {
+				return nil, fmt.Errorf("unknown escape '\\%c' in template", format[i])
+			}
+			lit.WriteByte(e)
+		case c == '%' && i+1 < len(format) && format[i+1] == '%':
+			i++
+			lit.WriteByte('%')
+		case c == '%':
+			// flags, width and precision
+			j := i + 1
+			for j < len(format) && strings.IndexByte("-+ #0123456789.", format[j]) >= 0 {
+				j++
+			}
+			if j >= len(format) {
+				return nil, fmt.Errorf("incomplete directive '%s' in template", format[i:])
+			}
+			spec := "%" + format[i+1:j] + "s"
+			field, n, err := printfField(format[j:], repositories)
+			if err != nil {
+				return nil, err
+			}
+			flushLiteral()
+			tmpl = append(tmpl, func(root string, r client.SearchResult) string {
+				return fmt.Sprintf(spec, field(root, r))
+			})
+			i = j + n - 1
+		default:
+			lit.WriteByte(c)
+		}
+	}
+	flushLiteral()
+	return tmpl, nil
+}
+
+// Field for the directive at the start of s, n is the directive length
+func printfField(s string, repositories map[int]string) (field func(string, client.SearchResult) string,
+	n int, err error) {
+	switch s[0] {
+	case 'p':
+		return func(_ string, r client.SearchResult) string { return r.ObjectPath }, 1, nil
+	case 'P':
+		return func(root string, r client.SearchResult) string {
+			return strings.TrimPrefix(strings.TrimPrefix(r.ObjectPath, root), "/")
+		}, 1, nil
+	case 'f':
+		return func(_ string, r client.SearchResult) string { return r.ObjectName }, 1, nil
+	case 'h':
+		return func(_ string, r client.SearchResult) string {
+			return client.ParentPath(r.ObjectPath)
+		}, 1, nil
+	case 's':
+		return func(_ string, r client.SearchResult) string {
+			return strconv.FormatUint(r.ObjectSize, 10)
+		}, 1, nil
+	case 'k':
+		return func(_ string, r client.SearchResult) string {
+			return strconv.FormatUint((r.ObjectSize+1023)/1024, 10)
+		}, 1, nil
+	case 'z':
+		return func(_ string, r client.SearchResult) string {
+			return log.SizeString(log.ByteSize(r.ObjectSize))
+		}, 1, nil
+	case 'y':
+		return func(_ string, r client.SearchResult) string {
+			if r.IsDir() {
+				return "d"
+			}
+			return "f"
+		}, 1, nil
+	case 'Y':
+		return func(_ string, r client.SearchResult) string { return r.ObjectType }, 1, nil
+	case 't':
+		return func(_ string, r client.SearchResult) string { return r.InstanceBackupDate }, 1, nil
+	case 'i':
+		return func(_ string, r client.SearchResult) string { return strconv.Itoa(r.InstanceId) }, 1, nil
+	case 'o':
+		return func(_ string, r client.SearchResult) string { return strconv.Itoa(r.ObjectId) }, 1, nil
+	case 'r':
+		return func(_ string, r client.SearchResult) string { return strconv.Itoa(r.RepositoryId) }, 1, nil
+	case 'R':
+		return func(_ string, r client.SearchResult) string {
+			return repositoryName(repositories, r.RepositoryId)
+		}, 1, nil
+	case 'T':
+		if len(s) < 2 {
+			return nil, 0, fmt.Errorf("missing date format after '%%T' in template")
+		}
+		switch k := s[1]; k {
+		case 's':
+			return func(_ string, r client.SearchResult) string {
+				return strconv.FormatInt(r.BackupTime().Unix(), 10)
+			}, 2, nil
+		case '@':
+			return func(_ string, r client.SearchResult) string {
+				t := r.BackupTime()
+				return fmt.Sprintf("%d.%09d", t.Unix(), t.Nanosecond())
+			}, 2, nil
+		case 'j':
+			return func(_ string, r client.SearchResult) string {
+				return fmt.Sprintf("%03d", r.BackupTime().YearDay())
+			}, 2, nil
+		default:
+			layout, ok := strftimeLayouts[k]
+			if !ok {
+				return nil, 0, fmt.Errorf("unknown date format '%%T%c' in template", k)
+			}
+			return func(_ string, r client.SearchResult) string {
+				return r.BackupTime().Format(layout)
+			}, 2, nil
+		}
+	default:
+		return nil, 0, fmt.Errorf("unknown directive '%%%c' in template", s[0])
+	}
+}
+
+func (t printfTemplate) format(root string, r client.SearchResult) string {
+	var b strings.Builder
+	for _, seg := range t {
+		b.WriteString(seg(root, r))
+	}
+	return b.String()
+}
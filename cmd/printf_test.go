@@ -0,0 +1,105 @@
+/*
+Copyright © 2022 Antonin Portelli <antonin.portelli@me.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aportelli/miria-cli/client"
+)
+
+func TestPrintf(t *testing.T) {
+	backup := time.Date(2026, 3, 1, 14, 5, 9, 0, time.Local)
+	r := client.SearchResult{ObjectPath: "archive@p:/data/run/out.h5", ObjectName: "out.h5",
+		ObjectSize: 1536, ObjectType: "FILE", InstanceBackupDate: backup.Format(client.BackupDateLayout),
+		InstanceId: 12, ObjectId: 34, RepositoryId: 2}
+	names := map[int]string{2: "tapeB"}
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{"%p", "archive@p:/data/run/out.h5"},
+		{"%P", "run/out.h5"},
+		{"%f in %h", "out.h5 in archive@p:/data/run"},
+		{"%s %k", "1536 2"},
+		{"%y %Y", "f FILE"},
+		{"%t", "2026-03-01T14:05:09"},
+		{"%TY/%Tm/%Td %TH:%TM:%TS", "2026/03/01 14:05:09"},
+		{"%TF %Tj", "2026-03-01 060"},
+		{"%Ts", strconv.FormatInt(backup.Unix(), 10)},
+		{"%i %o %r %R", "12 34 2 tapeB"},
+		{"%10s|%-8f|", "      1536|out.h5  |"},
+		{"100%% %f", "100% out.h5"},
+		{"%%R", "%R"},
+		{"a\\tb\\n\\\\", "a\tb\n\\"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		tmpl, err := compilePrintf(tt.format, names)
+		if err != nil {
+			t.Errorf("compilePrintf(%q): %s", tt.format, err)
+			continue
+		}
+		if got := tmpl.format("archive@p:/data", r); got != tt.want {
+			t.Errorf("compilePrintf(%q): got %q, want %q", tt.format, got, tt.want)
+		}
+	}
+}
+
+func TestPrintfErrors(t *testing.T) {
+	tests := []struct {
+		format string
+		err    string
+	}{
+		{"%", "incomplete directive '%' in template"},
+		{"%-5", "incomplete directive '%-5' in template"},
+		{"%x", "unknown directive '%x' in template"},
+		{"%T", "missing date format after '%T' in template"},
+		{"%Tq", "unknown date format '%Tq' in template"},
+		{"\\q", "unknown escape '\\q' in template"},
+	}
+	for _, tt := range tests {
+		_, err := compilePrintf(tt.format, nil)
+		if err == nil || err.Error() != tt.err {
+			t.Errorf("compilePrintf(%q): got error %v, want %q", tt.format, err, tt.err)
+		}
+	}
+}
+
+func TestPrintfRepository(t *testing.T) {
+	tests := []struct {
+		format string
+		names  bool
+	}{
+		{"%R", true},
+		{"%-10R %p", true},
+		{"%p %R", true},
+		{"%%R", false},
+		{"%%%R", true},
+		{"%%%%R", false},
+		{"a%%R%r", false},
+		{"%r", false},
+	}
+	for _, tt := range tests {
+		opt := outputOptions{Printf: tt.format}
+		if got := opt.needsRepositories(); got != tt.names {
+			t.Errorf("needsRepositories() for %q: got %v, want %v", tt.format, got, tt.names)
+		}
+	}
+}
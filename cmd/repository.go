@@ -0,0 +1,113 @@
+/*
+Copyright © 2022 Antonin Portelli <antonin.portelli@me.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	log "github.com/aportelli/golog"
+	"github.com/aportelli/miria-cli/client"
+	"github.com/spf13/cobra"
+)
+
+var repositoriesCmd = &cobra.Command{
+	Use:   "repositories",
+	Short: "List tape repositories",
+	Long: `List the IDs and names of the tape repositories. Names are cached for a day,
+use --refresh to update them.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		AuthenticateIfNecessary()
+		names, err := miria.RepositoryNames(repositoriesOpt.Refresh)
+		log.ErrorCheck(err, "")
+		ids := make([]int, 0, len(names))
+		for id := range names {
+			ids = append(ids, id)
+		}
+		sort.Ints(ids)
+		for _, id := range ids {
+			log.Msg.Printf("%6d %s", id, names[id])
+		}
+	},
+}
+
+var repositoriesOpt = struct{ Refresh bool }{false}
+
+func init() {
+	rootCmd.AddCommand(repositoriesCmd)
+	repositoriesCmd.Flags().BoolVar(&repositoriesOpt.Refresh, "refresh", false,
+		"update the cached repository names")
+}
+
+// Cached repository names
+func repositoryNames() (map[int]string, error) {
+	return miria.RepositoryNames(false)
+}
+
+// Repository names for a search, only from the cache if the local index is
+// searched, so that the server is not contacted
+func searchRepositoryNames(useIndex bool) func() (map[int]string, error) {
+	if useIndex {
+		return miria.CachedRepositoryNames
+	}
+	return repositoryNames
+}
+
+// Repository name, or ID if the name is unknown
+func repositoryName(names map[int]string, id int) string {
+	if name, ok := names[id]; ok {
+		return name
+	}
+	return strconv.Itoa(id)
+}
+
+// Repository filter flags ////////////////////////////////////////////////////
+type repositoryFlags struct {
+	Repositories []string
+}
+
+func addRepositoryFlags(cmd *cobra.Command, f *repositoryFlags) {
+	cmd.Flags().StringArrayVar(&f.Repositories, "repository", nil,
+		"only keep instances stored in this repository, given by ID or name (repeatable)")
+}
+
+// Resolve repositories to IDs, names are only fetched if needed
+func (f repositoryFlags) apply(opt *client.FindOptions, names func() (map[int]string, error)) error {
+	for _, r := range f.Repositories {
+		if id, err := strconv.Atoi(r); err == nil {
+			opt.Repositories = append(opt.Repositories, id)
+			continue
+		}
+		repoNames, err := names()
+		if err != nil {
+			return err
+		}
+		found := false
+		for id, name := range repoNames {
+			if name == r {
+				opt.Repositories = append(opt.Repositories, id)
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("unknown repository '%s', use `miria repositories` to list them", r)
+		}
+	}
+	return nil
+}
@@ -80,4 +80,10 @@ func init() {
 	} else {
 		miria = client.NewMiria("")
 	}
+	if viper.IsSet("concurrency") {
+		miria.SetConcurrency(viper.GetInt("concurrency"))
+	}
+	if viper.IsSet("page-size") {
+		miria.SetPageSize(viper.GetInt("page-size"))
+	}
 }
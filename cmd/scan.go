@@ -0,0 +1,170 @@
+/*
+Copyright © 2022 Antonin Portelli <antonin.portelli@me.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/aportelli/miria-cli/client"
+	"github.com/spf13/cobra"
+)
+
+// Run search and call process on each page of selected results, saving the
+// scan state if checkpointing is enabled. The scan stops after opt.Limit
+// results. Returns the checkpoint state, which contains the totals including
+// the ones of a resumed scan. When process is called, ck.state.Count is the
+// number of instances scanned so far, including the ones not selected yet.
+func runScan(opt client.FindOptions, ck *checkpointFlags,
+	process func([]client.SearchResult) error) (checkpoint, error) {
+	if ck.enabled() && opt.Split {
+		return ck.state, fmt.Errorf("a split search cannot be checkpointed")
+	}
+	if opt.Limit > 0 {
+		// results output before the interruption count in the limit
+		if ck.state.Offset >= uint64(opt.Limit) {
+			return ck.state, ck.done()
+		}
+		opt.Limit -= int(ck.state.Offset)
+	}
+	emit := func(results []client.SearchResult) error {
+		err := process(results)
+		if err != nil {
+			return err
+		}
+		for _, r := range results {
+			ck.state.Bytes += r.ObjectSize
+			if r.IsDir() {
+				ck.state.Dirs++
+			}
+			t := r.BackupTime()
+			if t.IsZero() {
+				continue
+			}
+			if ck.state.Earliest.IsZero() || t.Before(ck.state.Earliest) {
+				ck.state.Earliest = t
+			}
+			if t.After(ck.state.Latest) {
+				ck.state.Latest = t
+			}
+		}
+		ck.state.Offset += uint64(len(results))
+		return nil
+	}
+
+	// stop cleanly on interrupt, saving the last checkpoint
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	opt.Cursor = ck.state.Cursor
+	opt.Selected = ck.restored
+	scanned := ck.state.Count
+	it := miria.Find(ctx, opt)
+	defer it.Close()
+	for it.NextPage() {
+		results := it.Page()
+		ck.state.Count = scanned + uint64(it.Scanned())
+		err := emit(results)
+		if err != nil {
+			return ck.state, err
+		}
+		if ck.enabled() {
+			ck.pending = append(ck.pending, it.Selected()...)
+		}
+		// there is nothing to resume after the last page, printed results are
+		// always saved so that resuming does not print them again
+		if it.Cursor() != "" {
+			ck.state.Cursor = it.Cursor()
+			err = ck.save(ck.printed && len(results) > 0)
+			if err != nil {
+				return ck.state, err
+			}
+		}
+	}
+	if err := it.Err(); err != nil {
+		// the state is up to date with the last processed page
+		if serr := ck.save(true); serr != nil {
+			return ck.state, serr
+		}
+		if ctx.Err() != nil {
+			return ck.state, fmt.Errorf("search interrupted")
+		}
+		return ck.state, err
+	}
+	return ck.state, ck.done()
+}
+
+// Flags controlling how result pages are requested
+type fetchFlags struct {
+	Prefetch int
+	PageSize int
+	Split    bool
+}
+
+func (f fetchFlags) apply(opt *client.FindOptions) {
+	opt.Prefetch = f.Prefetch
+	opt.PageSize = f.PageSize
+	opt.Split = f.Split
+}
+
+func addFetchFlags(cmd *cobra.Command, f *fetchFlags) {
+	cmd.Flags().IntVar(&f.Prefetch, "prefetch", client.DefaultPrefetch,
+		"number of result pages fetched ahead")
+	cmd.Flags().IntVar(&f.PageSize, "page-size", 0,
+		"number of results per request (default from the page-size option, or 3000)")
+	cmd.Flags().BoolVar(&f.Split, "split", false,
+		"search subdirectories concurrently (see the concurrency option)")
+}
+
+// Flags of the commands scanning a path, on the server or in the local index
+type scanFlags struct {
+	Fetch        fetchFlags
+	Dates        dateFlags
+	Paths        pathFlags
+	Repositories repositoryFlags
+	Index        bool
+}
+
+// Apply the flags to the search of path p, which authenticates unless the
+// local index is used
+func (f scanFlags) apply(opt *client.FindOptions, p string) error {
+	f.Fetch.apply(opt)
+	err := f.Dates.apply(opt)
+	if err != nil {
+		return err
+	}
+	err = f.Paths.apply(opt)
+	if err != nil {
+		return err
+	}
+	opt.Path = p
+	err = selectIndex(opt, f.Index)
+	if err != nil {
+		return err
+	}
+	return f.Repositories.apply(opt, searchRepositoryNames(f.Index))
+}
+
+// Add the scan flags, index is the usage of --index
+func addScanFlags(cmd *cobra.Command, f *scanFlags, index string) {
+	addFetchFlags(cmd, &f.Fetch)
+	cmd.Flags().BoolVar(&f.Index, "index", false, index)
+	addDateFlags(cmd, &f.Dates)
+	addPathFlags(cmd, &f.Paths)
+	addRepositoryFlags(cmd, &f.Repositories)
+}
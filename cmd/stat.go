@@ -0,0 +1,127 @@
+/*
+Copyright © 2022 Antonin Portelli <antonin.portelli@me.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	log "github.com/aportelli/golog"
+	"github.com/aportelli/miria-cli/client"
+	"github.com/spf13/cobra"
+)
+
+// statCmd represents the stat command
+var statCmd = &cobra.Command{
+	Use:   "stat <path>",
+	Short: "Show all archived instances of an object",
+	Long: `Show the metadata of every archived instance of an object, oldest first: backup
+date, size, object and instance IDs, repository, type, and any other field
+returned by the server. Only the parent directory of the object is searched.
+
+Example:
+  miria stat archive@project:/dir/file.nc
+  miria stat archive@project:/dir/file.nc --json | jq '.instances | length'`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		AuthenticateIfNecessary()
+		p := client.CleanObjectPath(args[0])
+		instances, err := miria.Stat(context.Background(), p)
+		log.ErrorCheck(err, "")
+		if len(instances) == 0 {
+			log.Err.Fatalf("cannot stat '%s': no such file or directory", args[0])
+		}
+		names, err := repositoryNames()
+		if err != nil {
+			log.Dbg.Printf("cannot get repository names: %s", err.Error())
+		}
+		if statOpt.JSON {
+			err = writeStatJSON(p, instances, names)
+			log.ErrorCheck(err, "")
+			return
+		}
+		writeStatText(p, instances, names)
+	},
+}
+
+var statOpt = struct {
+	JSON     bool
+	Humanize bool
+}{false, false}
+
+func init() {
+	rootCmd.AddCommand(statCmd)
+	statCmd.Flags().BoolVar(&statOpt.JSON, "json", false, "print the instances as JSON")
+	statCmd.Flags().BoolVarP(&statOpt.Humanize, "human-readable", "H", false,
+		"human-readable sizes")
+	statCmd.Flags().Lookup("human-readable").NoOptDefVal = "true"
+}
+
+func writeStatText(p string, instances []client.ObjectInstance, names map[int]string) {
+	latest := instances[len(instances)-1]
+	kind := "file"
+	if latest.IsDir() {
+		kind = "directory"
+	}
+	log.Msg.Printf("Path:      %s", p)
+	log.Msg.Printf("Type:      %s", kind)
+	log.Msg.Printf("Instances: %d", len(instances))
+	for i, inst := range instances {
+		log.Msg.Printf("\nInstance %d/%d", i+1, len(instances))
+		log.Msg.Printf("  Backup date:  %s", inst.InstanceBackupDate)
+		log.Msg.Printf("  Size:         %s", sizeString(inst.ObjectSize, statOpt.Humanize))
+		log.Msg.Printf("  Object ID:    %d", inst.ObjectId)
+		log.Msg.Printf("  Instance ID:  %d", inst.InstanceId)
+		log.Msg.Printf("  Repository:   %s (%d)", repositoryName(names, inst.RepositoryId), inst.RepositoryId)
+		log.Msg.Printf("  Object type:  %s", inst.ObjectType)
+		keys := make([]string, 0, len(inst.Metadata))
+		for k := range inst.Metadata {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			log.Msg.Printf("  %-13s %v", k+":", inst.Metadata[k])
+		}
+	}
+}
+
+// Instance with the repository name and the extra server fields
+type statInstance struct {
+	namedResult
+	Metadata map[string]any `json:"metadata,omitempty"`
+}
+
+func writeStatJSON(p string, instances []client.ObjectInstance, names map[int]string) error {
+	out := struct {
+		Path      string         `json:"path"`
+		Instances []statInstance `json:"instances"`
+	}{Path: p}
+	for _, inst := range instances {
+		out.Instances = append(out.Instances, statInstance{
+			namedResult{inst.SearchResult, repositoryName(names, inst.RepositoryId)}, inst.Metadata})
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	err := enc.Encode(out)
+	if err != nil {
+		return fmt.Errorf("cannot write JSON: %s", err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,289 @@
+/*
+Copyright © 2022 Antonin Portelli <antonin.portelli@me.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	log "github.com/aportelli/golog"
+	"github.com/aportelli/miria-cli/client"
+	"github.com/spf13/cobra"
+)
+
+// statsCmd represents the stats command
+var statsCmd = &cobra.Command{
+	Use:   "stats <path>",
+	Short: "Show size, age and extension distributions of the files in the given path",
+	Long: `Show the distribution of the files in a given path, computed from a single scan
+similar to the ` + "`find`" + ` command:
+  - by size, in log-scale buckets (0, under 1kB, 1kB to 10kB, and so on);
+  - by backup date, per year, or per month with --monthly;
+  - by file extension, the largest --extensions ones.
+Each bucket has its number of files and total size. The text output renders
+them as bar charts, scaled by number of files, or by size with --by-size. By
+default, only the latest instance of each file is counted.
+
+Example:
+  miria stats archive@project:/dir
+  miria stats archive@project:/dir --monthly --since 2025-01-01 --by-size
+  miria stats archive@project:/dir --versions all --format json
+  miria stats archive@project:/dir --extensions 0 --format csv`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		switch statsOpt.Format {
+		case "text", "json", "csv", "tsv":
+		default:
+			log.Err.Fatalf("unknown format '%s' (possible values: [text json csv tsv])", statsOpt.Format)
+		}
+		err := statsOpt.Scan.apply(&statsOpt.Opt, args[0])
+		log.ErrorCheck(err, "")
+
+		s := newFileStats()
+		_, err = runScan(statsOpt.Opt, &checkpointFlags{}, func(results []client.SearchResult) error {
+			for _, r := range results {
+				s.add(r)
+			}
+			return nil
+		})
+		log.ErrorCheck(err, "")
+		h := s.histograms()
+		switch statsOpt.Format {
+		case "json":
+			err = writeStatsJSON(h)
+		case "csv", "tsv":
+			err = writeStatsCSV(h, statsOpt.Format == "tsv")
+		default:
+			writeStatsText(h)
+		}
+		log.ErrorCheck(err, "")
+	},
+}
+
+var statsOpt = struct {
+	Opt        client.FindOptions
+	Format     string
+	Monthly    bool
+	BySize     bool
+	Extensions int
+	Scan       scanFlags
+}{client.FindOptions{Path: "", Type: "f", Pattern: "*", MaxDepth: -1,
+	Versions: client.VersionsLatest}, "text", false, false, 10, scanFlags{}}
+
+func init() {
+	rootCmd.AddCommand(statsCmd)
+	statsCmd.Flags().StringVarP(&statsOpt.Format, "format", "f", "text",
+		"output format (text, json, csv or tsv)")
+	statsCmd.Flags().BoolVar(&statsOpt.Monthly, "monthly", false, "bucket backup dates per month")
+	statsCmd.Flags().BoolVar(&statsOpt.BySize, "by-size", false,
+		"scale bar charts by total size instead of number of files")
+	statsCmd.Flags().IntVar(&statsOpt.Extensions, "extensions", 10,
+		"number of extensions to show, the largest first (0 is all)")
+	statsCmd.Flags().StringVar(&statsOpt.Opt.Versions, "versions", client.VersionsLatest,
+		"instances to count for each file (all, latest or first)")
+	addScanFlags(statsCmd, &statsOpt.Scan, "scan the local index (see 'miria index')")
+}
+
+// Distributions of the scanned files /////////////////////////////////////////
+type statsBucket struct {
+	Bucket string `json:"bucket"`
+	Count  uint64 `json:"count"`
+	Bytes  uint64 `json:"bytes"`
+}
+
+type statsHistograms struct {
+	Sizes      []statsBucket `json:"sizes"`
+	Dates      []statsBucket `json:"dates"`
+	Extensions []statsBucket `json:"extensions"`
+}
+
+// Upper bounds of the size buckets, from 1kB to 1TB in steps of 10
+var statsSizeBounds = func() []uint64 {
+	var bounds []uint64
+	for _, unit := range []uint64{1 << 10, 1 << 20, 1 << 30} {
+		bounds = append(bounds, unit, 10*unit, 100*unit)
+	}
+	return append(bounds, 1<<40)
+}()
+
+type fileStats struct {
+	sizes      []statsBucket // empty files, then one per bound, then above the last
+	dates      map[string]*statsBucket
+	extensions map[string]*statsBucket
+}
+
+func newFileStats() *fileStats {
+	s := &fileStats{
+		sizes:      make([]statsBucket, len(statsSizeBounds)+2),
+		dates:      make(map[string]*statsBucket),
+		extensions: make(map[string]*statsBucket),
+	}
+	s.sizes[0].Bucket = "0"
+	lower := "0"
+	for i, b := range statsSizeBounds {
+		upper := statsSizeLabel(b)
+		s.sizes[i+1].Bucket = lower + "-" + upper
+		lower = upper
+	}
+	s.sizes[len(s.sizes)-1].Bucket = ">=" + lower
+	return s
+}
+
+// Size bound without decimals, e.g. 10MB
+func statsSizeLabel(size uint64) string {
+	units := []string{"B", "kB", "MB", "GB", "TB"}
+	i := 0
+	for size >= 1024 && size%1024 == 0 && i < len(units)-1 {
+		size /= 1024
+		i++
+	}
+	return strconv.FormatUint(size, 10) + units[i]
+}
+
+func addToBucket(m map[string]*statsBucket, key string, size uint64) {
+	b, ok := m[key]
+	if !ok {
+		b = &statsBucket{Bucket: key}
+		m[key] = b
+	}
+	b.Count++
+	b.Bytes += size
+}
+
+func (s *fileStats) add(r client.SearchResult) {
+	i := 0
+	if r.ObjectSize > 0 {
+		i = 1 + sort.Search(len(statsSizeBounds), func(k int) bool { return r.ObjectSize < statsSizeBounds[k] })
+	}
+	s.sizes[i].Count++
+	s.sizes[i].Bytes += r.ObjectSize
+
+	date := "unknown"
+	if t := r.BackupTime(); !t.IsZero() {
+		if statsOpt.Monthly {
+			date = t.Format("2006-01")
+		} else {
+			date = t.Format("2006")
+		}
+	}
+	addToBucket(s.dates, date, r.ObjectSize)
+
+	ext := strings.ToLower(path.Ext(r.ObjectName))
+	if ext == "" {
+		ext = "(none)"
+	}
+	addToBucket(s.extensions, ext, r.ObjectSize)
+}
+
+func (s *fileStats) histograms() statsHistograms {
+	h := statsHistograms{Sizes: s.sizes, Dates: []statsBucket{}, Extensions: []statsBucket{}}
+	for _, b := range s.dates {
+		h.Dates = append(h.Dates, *b)
+	}
+	sort.Slice(h.Dates, func(i, j int) bool { return h.Dates[i].Bucket < h.Dates[j].Bucket })
+	for _, b := range s.extensions {
+		h.Extensions = append(h.Extensions, *b)
+	}
+	sort.Slice(h.Extensions, func(i, j int) bool {
+		a, b := h.Extensions[i], h.Extensions[j]
+		if a.Bytes != b.Bytes {
+			return a.Bytes > b.Bytes
+		}
+		return a.Bucket < b.Bucket
+	})
+	if statsOpt.Extensions > 0 && len(h.Extensions) > statsOpt.Extensions {
+		h.Extensions = h.Extensions[:statsOpt.Extensions]
+	}
+	return h
+}
+
+// Outputs ////////////////////////////////////////////////////////////////////
+const statsBarWidth = 40
+
+func writeStatsText(h statsHistograms) {
+	sections := []struct {
+		title   string
+		buckets []statsBucket
+	}{{"Size", h.Sizes}, {"Backup date", h.Dates}, {"Extension", h.Extensions}}
+	for i, sec := range sections {
+		if i > 0 {
+			log.Msg.Println()
+		}
+		log.Msg.Printf("%-14s %10s %10s", sec.title, "files", "size")
+		var max uint64
+		for _, b := range sec.buckets {
+			if v := statsBarValue(b); v > max {
+				max = v
+			}
+		}
+		for _, b := range sec.buckets {
+			bar := 0
+			if max > 0 {
+				bar = int((statsBarValue(b)*statsBarWidth + max - 1) / max)
+			}
+			log.Msg.Printf("%-14s %10d %10s %s", b.Bucket, b.Count, log.SizeString(log.ByteSize(b.Bytes)),
+				strings.Repeat("#", bar))
+		}
+	}
+}
+
+func statsBarValue(b statsBucket) uint64 {
+	if statsOpt.BySize {
+		return b.Bytes
+	}
+	return b.Count
+}
+
+func writeStatsJSON(h statsHistograms) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(h)
+}
+
+func writeStatsCSV(h statsHistograms, tsv bool) error {
+	w := csv.NewWriter(os.Stdout)
+	if tsv {
+		w.Comma = '\t'
+	}
+	err := w.Write([]string{"histogram", "bucket", "count", "bytes"})
+	if err != nil {
+		return err
+	}
+	for _, sec := range []struct {
+		name    string
+		buckets []statsBucket
+	}{{"size", h.Sizes}, {"date", h.Dates}, {"extension", h.Extensions}} {
+		for _, b := range sec.buckets {
+			err = w.Write([]string{sec.name, b.Bucket, strconv.FormatUint(b.Count, 10),
+				strconv.FormatUint(b.Bytes, 10)})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	w.Flush()
+	if err = w.Error(); err != nil {
+		return fmt.Errorf("cannot write CSV: %s", err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,230 @@
+/*
+Copyright © 2022 Antonin Portelli <antonin.portelli@me.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"container/heap"
+	"sort"
+	"time"
+
+	log "github.com/aportelli/golog"
+	"github.com/aportelli/miria-cli/client"
+	"github.com/spf13/cobra"
+)
+
+// topCmd represents the top command
+var topCmd = &cobra.Command{
+	Use:   "top <path>",
+	Short: "Show the largest files or directories in the given path",
+	Long: `Show the largest files (--files, default) or directories (--dirs) in a given
+path, from a full scan similar to the ` + "`find`" + ` command. By default, only the
+latest instance of each file is counted, as with ` + "`du`" + `, ` + "`stats`" + ` and
+` + "`ncdu`" + `. Results are streamed, and only the path, size and backup date of
+the selected instance of each file are kept until the end of the scan.
+
+With --versions all, every instance is counted and nothing is kept per file:
+only the -n largest files are kept in memory during the scan, and one total per
+directory with --dirs. This is the cheapest mode for very large trees, but a
+file archived several times then appears once per instance, and directory sizes
+include all of them, i.e. the tape consumption.
+
+Each line shows the size, the number of files, the latest backup date and the
+path. Directory sizes are aggregated from the files they contain, at any depth.
+
+Example:
+  miria top archive@project:/dir -n 50 -H
+  miria top archive@project:/dir --dirs -n 20
+  miria top archive@project:/dir --versions all --since 2026-01-01
+  miria top archive@project:/dir --dirs --index`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if topOpt.Files && topOpt.Dirs {
+			log.Err.Fatalln("--files and --dirs cannot be used together")
+		}
+		if topOpt.N < 1 {
+			log.Err.Fatalln("-n must be at least 1")
+		}
+		err := topOpt.Scan.apply(&topOpt.Opt, args[0])
+		log.ErrorCheck(err, "")
+
+		top := &topHeap{}
+		var entries []topEntry
+		if topOpt.Dirs {
+			entries, err = topDirs(topOpt.Opt, top)
+		} else {
+			entries, err = topFiles(topOpt.Opt, top)
+		}
+		log.ErrorCheck(err, "")
+		for _, e := range entries {
+			date := "-"
+			if !e.Latest.IsZero() {
+				date = e.Latest.Format(client.BackupDateLayout)
+			}
+			log.Msg.Printf("%12s %8d %20s %s", sizeString(e.Size, topOpt.Humanize), e.Count, date, e.Path)
+		}
+	},
+}
+
+var topOpt = struct {
+	Opt      client.FindOptions
+	N        int
+	Files    bool
+	Dirs     bool
+	Humanize bool
+	Scan     scanFlags
+}{client.FindOptions{Path: "", Type: "f", Pattern: "*", MaxDepth: -1,
+	Versions: client.VersionsLatest}, 10, false, false, false, scanFlags{}}
+
+func init() {
+	rootCmd.AddCommand(topCmd)
+	topCmd.Flags().IntVarP(&topOpt.N, "number", "n", 10, "number of entries to show")
+	topCmd.Flags().BoolVar(&topOpt.Files, "files", false, "show the largest files (default)")
+	topCmd.Flags().BoolVar(&topOpt.Dirs, "dirs", false, "show the largest directories")
+	topCmd.Flags().BoolVarP(&topOpt.Humanize, "human-readable", "H", false,
+		"human-readable sizes")
+	topCmd.Flags().Lookup("human-readable").NoOptDefVal = "true"
+	topCmd.Flags().StringVar(&topOpt.Opt.Versions, "versions", client.VersionsLatest,
+		"instances to count for each file (all, latest or first)")
+	addScanFlags(topCmd, &topOpt.Scan, "scan the local index (see 'miria index')")
+}
+
+// Selected instance of a file, only with the fields shown by top
+type topInstance struct {
+	entry topEntry
+	id    int
+}
+
+// Whether instance a is newer than b, using the instance ID to break ties
+func (a topInstance) newer(b topInstance) bool {
+	if a.entry.Latest.Equal(b.entry.Latest) {
+		return a.id > b.id
+	}
+	return a.entry.Latest.After(b.entry.Latest)
+}
+
+// Scan the files and call add on each selected instance. All instances are
+// streamed to add with --versions all, otherwise only one record per file is
+// kept during the scan, and add is called at the end.
+func topScan(opt client.FindOptions, add func(topEntry)) error {
+	mode := opt.Versions
+	if _, err := client.NewVersionSelector(mode); err != nil {
+		return err
+	}
+	opt.Versions = client.VersionsAll
+	latest := mode == client.VersionsLatest
+	best := make(map[any]topInstance)
+	_, err := runScan(opt, &checkpointFlags{}, func(results []client.SearchResult) error {
+		for _, r := range results {
+			inst := topInstance{entry: topEntry{Path: r.ObjectPath, Size: r.ObjectSize, Count: 1,
+				Latest: r.BackupTime()}, id: r.InstanceId}
+			if mode == client.VersionsAll {
+				add(inst.entry)
+				continue
+			}
+			key := client.ObjectKey(r)
+			if b, ok := best[key]; !ok || inst.newer(b) == latest {
+				best[key] = inst
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, inst := range best {
+		add(inst.entry)
+	}
+	return nil
+}
+
+// Largest files, streamed through the heap
+func topFiles(opt client.FindOptions, top *topHeap) ([]topEntry, error) {
+	err := topScan(opt, func(e topEntry) {
+		top.add(e, topOpt.N)
+	})
+	return top.sorted(), err
+}
+
+// Largest directories below the path, aggregated from the scanned files
+func topDirs(opt client.FindOptions, top *topHeap) ([]topEntry, error) {
+	root := client.CleanObjectPath(opt.Path)
+	dirs := make(map[string]*topEntry)
+	err := topScan(opt, func(f topEntry) {
+		for dir := client.ParentPath(f.Path); dir != root && client.UnderPath(dir, root); dir = client.ParentPath(dir) {
+			e, ok := dirs[dir]
+			if !ok {
+				e = &topEntry{Path: dir}
+				dirs[dir] = e
+			}
+			e.Size += f.Size
+			e.Count++
+			if f.Latest.After(e.Latest) {
+				e.Latest = f.Latest
+			}
+		}
+	})
+	for _, e := range dirs {
+		top.add(*e, topOpt.N)
+	}
+	return top.sorted(), err
+}
+
+// Bounded min-heap of the largest entries ////////////////////////////////////
+type topEntry struct {
+	Path   string
+	Size   uint64
+	Count  uint64
+	Latest time.Time
+}
+
+type topHeap []topEntry
+
+func (h topHeap) Len() int { return len(h) }
+func (h topHeap) Less(i, j int) bool {
+	if h[i].Size != h[j].Size {
+		return h[i].Size < h[j].Size
+	}
+	return h[i].Path > h[j].Path
+}
+func (h topHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *topHeap) Push(x interface{}) { *h = append(*h, x.(topEntry)) }
+func (h *topHeap) Pop() interface{} {
+	old := *h
+	e := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return e
+}
+
+// Add an entry, keeping at most n of the largest ones
+func (h *topHeap) add(e topEntry, n int) {
+	if h.Len() < n {
+		heap.Push(h, e)
+		return
+	}
+	small := (*h)[0]
+	if e.Size > small.Size || e.Size == small.Size && e.Path < small.Path {
+		(*h)[0] = e
+		heap.Fix(h, 0)
+	}
+}
+
+// Entries from the largest to the smallest
+func (h topHeap) sorted() []topEntry {
+	entries := append([]topEntry{}, h...)
+	sort.Slice(entries, func(i, j int) bool { return topHeap(entries).Less(j, i) })
+	return entries
+}
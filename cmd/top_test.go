@@ -0,0 +1,86 @@
+/*
+Copyright © 2022 Antonin Portelli <antonin.portelli@me.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTopHeap(t *testing.T) {
+	entries := []topEntry{
+		{Path: "archive@p:/a", Size: 4},
+		{Path: "archive@p:/b", Size: 16},
+		{Path: "archive@p:/c", Size: 1},
+		{Path: "archive@p:/d", Size: 8},
+		// same size, the first path in order is kept
+		{Path: "archive@p:/f", Size: 4},
+		{Path: "archive@p:/e", Size: 4},
+		{Path: "archive@p:/g", Size: 2},
+	}
+	tests := []struct {
+		n    int
+		want []string
+	}{
+		{1, []string{"archive@p:/b"}},
+		{3, []string{"archive@p:/b", "archive@p:/d", "archive@p:/a"}},
+		{4, []string{"archive@p:/b", "archive@p:/d", "archive@p:/a", "archive@p:/e"}},
+		{10, []string{"archive@p:/b", "archive@p:/d", "archive@p:/a", "archive@p:/e", "archive@p:/f",
+			"archive@p:/g", "archive@p:/c"}},
+	}
+	for _, tt := range tests {
+		// the result does not depend on the order of the entries
+		for _, reversed := range []bool{false, true} {
+			top := &topHeap{}
+			for i := range entries {
+				if reversed {
+					i = len(entries) - 1 - i
+				}
+				top.add(entries[i], tt.n)
+			}
+			var got []string
+			for _, e := range top.sorted() {
+				got = append(got, e.Path)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("n = %d, reversed %v: got %v, want %v", tt.n, reversed, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestTopInstanceNewer(t *testing.T) {
+	old := topInstance{entry: topEntry{Latest: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)}, id: 2}
+	recent := topInstance{entry: topEntry{Latest: time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)}, id: 1}
+	// same backup date, the instance ID breaks the tie
+	tie := topInstance{entry: topEntry{Latest: old.entry.Latest}, id: 3}
+	tests := []struct {
+		a, b topInstance
+		want bool
+	}{
+		{recent, old, true},
+		{old, recent, false},
+		{tie, old, true},
+		{old, tie, false},
+	}
+	for i, tt := range tests {
+		if got := tt.a.newer(tt.b); got != tt.want {
+			t.Errorf("test %d: got %v, want %v", i, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+/*
+Copyright © 2022 Antonin Portelli <antonin.portelli@me.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	log "github.com/aportelli/golog"
+	"github.com/aportelli/miria-cli/client"
+	"github.com/spf13/cobra"
+)
+
+// treeCmd represents the tree command
+var treeCmd = &cobra.Command{
+	Use:   "tree <path>",
+	Short: "Show the contents of the given path as a tree",
+	Long: `Show the contents of a given path as a tree, mimicking the ` + "`tree`" + ` Unix
+command. Entries are sorted by name, up to -L levels below the path, and only
+directories are shown with -d.
+
+With --du, the size of each file and the total size of each directory are
+shown, and with --count the number of files below each directory. Both need a
+scan of the whole path, whatever the depth limit. By default, only the latest
+instance of each file is counted.
+
+With --json, the tree is printed as nested JSON objects with the name, type,
+size and number of files of each entry.
+
+Example:
+  miria tree archive@project:/dir -L 2
+  miria tree archive@project:/dir -d --du -H
+  miria tree archive@project:/dir --count --json`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		err := treeOpt.Scan.apply(&treeOpt.Opt, args[0])
+		log.ErrorCheck(err, "")
+		if !treeOpt.Du && !treeOpt.Count {
+			// sizes are not needed, the server can skip deeper levels
+			treeOpt.Opt.MaxDepth = treeOpt.Level
+			if treeOpt.DirsOnly {
+				treeOpt.Opt.Type = "d"
+			}
+		}
+
+		root := client.CleanObjectPath(treeOpt.Opt.Path)
+		tree := &ncduNode{Name: root, Dir: true}
+		_, err = runScan(treeOpt.Opt, &checkpointFlags{}, func(results []client.SearchResult) error {
+			for _, r := range results {
+				tree.add(root, r)
+			}
+			return nil
+		})
+		log.ErrorCheck(err, "")
+		tree = treeView(tree, treeOpt.Level)
+		if treeOpt.JSON {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			err = enc.Encode(tree)
+			log.ErrorCheck(err, "")
+			return
+		}
+		var dirs, files int
+		log.Msg.Println(treeLabel(tree) + printable(tree.Name))
+		printTree(tree, "", &dirs, &files)
+		if treeOpt.DirsOnly {
+			log.Msg.Printf("\n%d directories", dirs)
+		} else {
+			log.Msg.Printf("\n%d directories, %d files", dirs, files)
+		}
+	},
+}
+
+var treeOpt = struct {
+	Opt      client.FindOptions
+	Level    int
+	DirsOnly bool
+	Du       bool
+	Count    bool
+	Humanize bool
+	JSON     bool
+	Scan     scanFlags
+}{client.FindOptions{Path: "", Type: "", Pattern: "*", MaxDepth: -1,
+	Versions: client.VersionsLatest}, -1, false, false, false, false, false, scanFlags{}}
+
+func init() {
+	rootCmd.AddCommand(treeCmd)
+	treeCmd.Flags().IntVarP(&treeOpt.Level, "level", "L", -1,
+		"only show entries up to this depth below the path (-1 is unlimited)")
+	treeCmd.Flags().BoolVarP(&treeOpt.DirsOnly, "dirs-only", "d", false, "only show directories")
+	treeCmd.Flags().BoolVar(&treeOpt.Du, "du", false, "show sizes, including the contents of directories")
+	treeCmd.Flags().BoolVar(&treeOpt.Count, "count", false, "show the number of files below directories")
+	treeCmd.Flags().BoolVarP(&treeOpt.Humanize, "human-readable", "H", false,
+		"human-readable sizes")
+	treeCmd.Flags().Lookup("human-readable").NoOptDefVal = "true"
+	treeCmd.Flags().BoolVar(&treeOpt.JSON, "json", false, "print the tree as JSON")
+	treeCmd.Flags().StringVar(&treeOpt.Opt.Versions, "versions", client.VersionsLatest,
+		"instances to count for each file (all, latest or first)")
+	addScanFlags(treeCmd, &treeOpt.Scan, "scan the local index (see 'miria index')")
+}
+
+// Copy of the tree with the entries shown, sorted by name, up to level below n
+func treeView(n *ncduNode, level int) *ncduNode {
+	v := &ncduNode{Name: n.Name, Dir: n.Dir, Size: n.Size, Count: n.Count}
+	if level == 0 {
+		return v
+	}
+	for _, c := range n.Children {
+		if !treeOpt.DirsOnly || c.Dir {
+			v.Children = append(v.Children, treeView(c, level-1))
+		}
+	}
+	sort.Slice(v.Children, func(i, j int) bool { return v.Children[i].Name < v.Children[j].Name })
+	return v
+}
+
+// Size and number of files in brackets, if requested
+func treeLabel(n *ncduNode) string {
+	var fields []string
+	if treeOpt.Du {
+		fields = append(fields, fmt.Sprintf("%12s", sizeString(n.Size, treeOpt.Humanize)))
+	}
+	if treeOpt.Count && n.Dir {
+		fields = append(fields, fmt.Sprintf("%8d", n.Count))
+	} else if treeOpt.Count {
+		fields = append(fields, fmt.Sprintf("%8s", ""))
+	}
+	if len(fields) == 0 {
+		return ""
+	}
+	return "[" + strings.Join(fields, " ") + "]  "
+}
+
+func printTree(n *ncduNode, prefix string, dirs *int, files *int) {
+	for i, c := range n.Children {
+		branch, next := "├── ", "│   "
+		if i == len(n.Children)-1 {
+			branch, next = "└── ", "    "
+		}
+		name := printable(c.Name)
+		if c.Dir {
+			*dirs++
+		} else {
+			*files++
+		}
+		log.Msg.Println(prefix + branch + treeLabel(c) + name)
+		printTree(c, prefix+next, dirs, files)
+	}
+}
@@ -0,0 +1,173 @@
+/*
+Copyright © 2022 Antonin Portelli <antonin.portelli@me.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	log "github.com/aportelli/golog"
+	"github.com/aportelli/miria-cli/client"
+	"github.com/spf13/cobra"
+)
+
+// versionsCmd represents the versions command
+var versionsCmd = &cobra.Command{
+	Use:   "versions <path>",
+	Short: "Show the version history of an object",
+	Long: `List every archived instance of an object in chronological order, with its
+backup date, size and size change from the previous version.
+
+With --as-of, the version that was current at the given date, i.e. the latest
+one backed up at or before it, is marked with '*'. A plain day includes the
+whole day.
+
+Example:
+  miria versions archive@project:/dir/file.nc -H
+  miria versions archive@project:/dir/file.nc --as-of 2026-03-31
+  miria versions archive@project:/dir/file.nc --as-of 6m --json`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		var opt client.FindOptions
+
+		err := dateFlags{AsOf: versionsOpt.AsOf}.apply(&opt)
+		log.ErrorCheck(err, "")
+		AuthenticateIfNecessary()
+		p := client.CleanObjectPath(args[0])
+		instances, err := miria.Stat(context.Background(), p)
+		log.ErrorCheck(err, "")
+		if len(instances) == 0 {
+			log.Err.Fatalf("cannot access '%s': no such file or directory", args[0])
+		}
+		names, err := repositoryNames()
+		if err != nil {
+			log.Dbg.Printf("cannot get repository names: %s", err.Error())
+		}
+		current := currentVersion(instances, opt.AsOf)
+		if versionsOpt.JSON {
+			err = writeVersionsJSON(p, instances, opt.AsOf, current, names)
+			log.ErrorCheck(err, "")
+			return
+		}
+		for i, inst := range instances {
+			mark := " "
+			if i == current {
+				mark = "*"
+			}
+			log.Msg.Printf("%s %4d %20s %12s %13s %8s %d", mark, i+1, inst.InstanceBackupDate,
+				sizeString(inst.ObjectSize, versionsOpt.Humanize), versionChange(instances, i),
+				repositoryName(names, inst.RepositoryId), inst.InstanceId)
+		}
+		if opt.AsOf.IsZero() {
+			return
+		}
+		if current < 0 {
+			log.Msg.Printf("\nNo version archived on %s", opt.AsOf.Format(client.BackupDateLayout))
+		} else {
+			log.Msg.Printf("\nVersion %d was current on %s", current+1, opt.AsOf.Format(client.BackupDateLayout))
+		}
+	},
+}
+
+var versionsOpt = struct {
+	AsOf     string
+	JSON     bool
+	Humanize bool
+}{"", false, false}
+
+func init() {
+	rootCmd.AddCommand(versionsCmd)
+	versionsCmd.Flags().StringVar(&versionsOpt.AsOf, "as-of", "",
+		"mark the version current at this date (YYYY-MM-DD[THH:MM:SS] or relative, e.g. 6m)")
+	versionsCmd.Flags().BoolVar(&versionsOpt.JSON, "json", false, "print the versions as JSON")
+	versionsCmd.Flags().BoolVarP(&versionsOpt.Humanize, "human-readable", "H", false,
+		"human-readable sizes")
+	versionsCmd.Flags().Lookup("human-readable").NoOptDefVal = "true"
+}
+
+// Index of the latest instance backed up at or before asOf, -1 if there is
+// none or asOf is zero. Backup dates have a one second resolution.
+func currentVersion(instances []client.ObjectInstance, asOf time.Time) int {
+	current := -1
+	if asOf.IsZero() {
+		return current
+	}
+	asOf = asOf.Truncate(time.Second)
+	for i, inst := range instances {
+		if t := inst.BackupTime(); !t.IsZero() && !t.After(asOf) {
+			current = i
+		}
+	}
+	return current
+}
+
+// Size change from the previous instance, in bytes
+func versionDelta(instances []client.ObjectInstance, i int) int64 {
+	if i == 0 {
+		return int64(instances[0].ObjectSize)
+	}
+	return int64(instances[i].ObjectSize) - int64(instances[i-1].ObjectSize)
+}
+
+// Signed size change, "new" for the first version
+func versionChange(instances []client.ObjectInstance, i int) string {
+	if i == 0 {
+		return "new"
+	}
+	d := versionDelta(instances, i)
+	switch {
+	case d > 0:
+		return "+" + sizeString(uint64(d), versionsOpt.Humanize)
+	case d < 0:
+		return "-" + sizeString(uint64(-d), versionsOpt.Humanize)
+	}
+	return "0"
+}
+
+type versionEntry struct {
+	namedResult
+	Version    int   `json:"version"`
+	SizeChange int64 `json:"sizeChange"`
+	Current    bool  `json:"current,omitempty"`
+}
+
+func writeVersionsJSON(p string, instances []client.ObjectInstance, asOf time.Time, current int,
+	names map[int]string) error {
+	out := struct {
+		Path     string         `json:"path"`
+		AsOf     string         `json:"asOf,omitempty"`
+		Versions []versionEntry `json:"versions"`
+	}{Path: p}
+	if !asOf.IsZero() {
+		out.AsOf = asOf.Format(client.BackupDateLayout)
+	}
+	for i, inst := range instances {
+		out.Versions = append(out.Versions, versionEntry{
+			namedResult{inst.SearchResult, repositoryName(names, inst.RepositoryId)},
+			i + 1, versionDelta(instances, i), i == current})
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	err := enc.Encode(out)
+	if err != nil {
+		return fmt.Errorf("cannot write JSON: %s", err.Error())
+	}
+	return nil
+}
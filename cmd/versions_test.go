@@ -0,0 +1,55 @@
+/*
+Copyright © 2022 Antonin Portelli <antonin.portelli@me.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aportelli/miria-cli/client"
+)
+
+func TestCurrentVersion(t *testing.T) {
+	var instances []client.ObjectInstance
+	// oldest first, as returned by Stat, one date cannot be parsed
+	for _, date := range []string{"2026-01-01T00:00:00", "2026-02-01T12:30:00", "unknown",
+		"2026-03-01T00:00:00"} {
+		instances = append(instances, client.ObjectInstance{
+			SearchResult: client.SearchResult{ObjectPath: "archive@p:/a", InstanceBackupDate: date}})
+	}
+	tests := []struct {
+		asOf time.Time
+		want int
+	}{
+		{time.Time{}, -1},
+		{time.Date(2025, 12, 31, 0, 0, 0, 0, time.Local), -1},
+		{time.Date(2026, 1, 1, 0, 0, 0, 0, time.Local), 0},
+		{time.Date(2026, 2, 1, 12, 29, 59, 0, time.Local), 0},
+		// backup dates have a one second resolution
+		{time.Date(2026, 2, 1, 12, 30, 0, 500000000, time.Local), 1},
+		{time.Date(2026, 2, 15, 0, 0, 0, 0, time.Local), 1},
+		{time.Date(2026, 6, 1, 0, 0, 0, 0, time.Local), 3},
+	}
+	for _, tt := range tests {
+		if got := currentVersion(instances, tt.asOf); got != tt.want {
+			t.Errorf("as of %v: got %d, want %d", tt.asOf, got, tt.want)
+		}
+	}
+	if got := currentVersion(nil, time.Now()); got != -1 {
+		t.Errorf("no instance: got %d, want -1", got)
+	}
+}